@@ -0,0 +1,123 @@
+package helper
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ParseRsaPrivateKey parses a PEM RSA private key in the PKCS#1 format Salt uses, or in PKCS#8.
+func ParseRsaPrivateKey(privateKeyPem string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(privateKeyPem))
+
+	if block == nil || !strings.Contains(block.Type, "PRIVATE KEY") {
+		return nil, errors.New("failed to parse PEM block containing the private key")
+	}
+
+	if block.Type == "PRIVATE KEY" {
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("the private key is not an RSA key")
+		}
+		return rsaKey, nil
+	}
+
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// PrivateKeyToPkcs8 converts a PEM RSA private key to the PKCS#8 PEM format.
+func PrivateKeyToPkcs8(privateKeyPem string) (string, error) {
+	key, err := ParseRsaPrivateKey(privateKeyPem)
+	if err != nil {
+		return "", err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// PrivateKeyToOpenSSH converts a PEM RSA private key to the unencrypted OpenSSH format,
+// see https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.key.
+func PrivateKeyToOpenSSH(privateKeyPem string) (string, error) {
+	key, err := ParseRsaPrivateKey(privateKeyPem)
+	if err != nil {
+		return "", err
+	}
+	key.Precompute()
+
+	publicKey, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	var check [4]byte
+	if _, err := rand.Read(check[:]); err != nil {
+		return "", err
+	}
+	checkInt := binary.BigEndian.Uint32(check[:])
+
+	privateBlock := ssh.Marshal(struct {
+		Check1  uint32
+		Check2  uint32
+		Keytype string
+		N       *big.Int
+		E       *big.Int
+		D       *big.Int
+		Iqmp    *big.Int
+		P       *big.Int
+		Q       *big.Int
+		Comment string
+	}{
+		Check1:  checkInt,
+		Check2:  checkInt,
+		Keytype: ssh.KeyAlgoRSA,
+		N:       key.N,
+		E:       big.NewInt(int64(key.E)),
+		D:       key.D,
+		Iqmp:    key.Precomputed.Qinv,
+		P:       key.Primes[0],
+		Q:       key.Primes[1],
+	})
+	// Pad the private section to the block size of the "none" cipher
+	for i := byte(1); len(privateBlock)%8 != 0; i++ {
+		privateBlock = append(privateBlock, i)
+	}
+
+	body := ssh.Marshal(struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}{
+		CipherName:   "none",
+		KdfName:      "none",
+		NumKeys:      1,
+		PubKey:       publicKey.Marshal(),
+		PrivKeyBlock: privateBlock,
+	})
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: append([]byte("openssh-key-v1\x00"), body...)})), nil
+}
+
+// KeyToBase64 encodes a PEM key on a single line, e.g. for the `encoding: b64` files of cloud-init.
+func KeyToBase64(keyPem string) string {
+	return base64.StdEncoding.EncodeToString([]byte(keyPem))
+}
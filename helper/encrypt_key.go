@@ -0,0 +1,113 @@
+package helper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	agearmor "filippo.io/age/armor"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgparmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+const pgpPublicKeyBlock = "-----BEGIN PGP PUBLIC KEY BLOCK-----"
+
+// ValidateKeyRecipient checks that a recipient is an age X25519 public key, e.g. `age1...`,
+// or an armored PGP public key.
+func ValidateKeyRecipient(recipient string) error {
+	if isPgpRecipient(recipient) {
+		_, err := openpgp.ReadArmoredKeyRing(strings.NewReader(recipient))
+		return err
+	}
+	_, err := age.ParseX25519Recipient(strings.TrimSpace(recipient))
+	return err
+}
+
+// EncryptKey encrypts a key to the given recipients, in ASCII armor, so that any of them can decrypt it.
+// The recipients must be all age public keys, which returns an age file, or all armored PGP public keys,
+// which returns a PGP message.
+func EncryptKey(key string, recipients []string) (string, error) {
+	if len(recipients) == 0 {
+		return "", errors.New("no recipient to encrypt the key to")
+	}
+
+	pgp := isPgpRecipient(recipients[0])
+	for _, recipient := range recipients[1:] {
+		if isPgpRecipient(recipient) != pgp {
+			return "", errors.New("the recipients must be all age public keys or all PGP public keys")
+		}
+	}
+
+	if pgp {
+		return encryptPgp(key, recipients)
+	}
+	return encryptAge(key, recipients)
+}
+
+func encryptAge(key string, recipients []string) (string, error) {
+	var to []age.Recipient
+	for _, recipient := range recipients {
+		r, err := age.ParseX25519Recipient(strings.TrimSpace(recipient))
+		if err != nil {
+			return "", err
+		}
+		to = append(to, r)
+	}
+
+	var out bytes.Buffer
+	armor := agearmor.NewWriter(&out)
+	w, err := age.Encrypt(armor, to...)
+	if err != nil {
+		return "", err
+	}
+	if err := writeAndClose(w, key); err != nil {
+		return "", err
+	}
+	if err := armor.Close(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func encryptPgp(key string, recipients []string) (string, error) {
+	var to openpgp.EntityList
+	for _, recipient := range recipients {
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(recipient))
+		if err != nil {
+			return "", err
+		}
+		to = append(to, entities...)
+	}
+
+	var out bytes.Buffer
+	armor, err := pgparmor.Encode(&out, "PGP MESSAGE", nil)
+	if err != nil {
+		return "", err
+	}
+	w, err := openpgp.Encrypt(armor, to, nil, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt to the PGP recipients: %w", err)
+	}
+	if err := writeAndClose(w, key); err != nil {
+		return "", err
+	}
+	if err := armor.Close(); err != nil {
+		return "", err
+	}
+	out.WriteString("\n")
+	return out.String(), nil
+}
+
+func writeAndClose(w io.WriteCloser, content string) error {
+	if _, err := io.WriteString(w, content); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func isPgpRecipient(recipient string) bool {
+	return strings.HasPrefix(strings.TrimSpace(recipient), pgpPublicKeyBlock)
+}
@@ -0,0 +1,104 @@
+package helper
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	agearmor "filippo.io/age/armor"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgparmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+func TestEncryptKeyAge(t *testing.T) {
+	privateKey, _, _ := GenerateRsaKeyPair(2048)
+	first, _ := age.GenerateX25519Identity()
+	second, _ := age.GenerateX25519Identity()
+
+	encrypted, err := EncryptKey(privateKey, []string{first.Recipient().String(), second.Recipient().String()})
+	if err != nil {
+		t.Fatalf("The function fails: %v", err)
+	}
+	if !strings.HasPrefix(encrypted, agearmor.Header) {
+		t.Fatalf("The encrypted key is not an armored age file")
+	}
+
+	for _, identity := range []*age.X25519Identity{first, second} {
+		r, err := age.Decrypt(agearmor.NewReader(strings.NewReader(encrypted)), identity)
+		if err != nil {
+			t.Fatalf("The encrypted key can not be decrypted: %v", err)
+		}
+		if decrypted, _ := io.ReadAll(r); string(decrypted) != privateKey {
+			t.Fatalf("The decrypted key is not the private key")
+		}
+	}
+}
+
+func TestEncryptKeyPgp(t *testing.T) {
+	privateKey, _, _ := GenerateRsaKeyPair(2048)
+	entity, _ := openpgp.NewEntity("minion", "", "minion@domain.com", nil)
+
+	encrypted, err := EncryptKey(privateKey, []string{armoredPgpPublicKey(t, entity)})
+	if err != nil {
+		t.Fatalf("The function fails: %v", err)
+	}
+
+	block, err := pgparmor.Decode(strings.NewReader(encrypted))
+	if err != nil || block.Type != "PGP MESSAGE" {
+		t.Fatalf("The encrypted key is not an armored PGP message: %v", err)
+	}
+	md, err := openpgp.ReadMessage(block.Body, openpgp.EntityList{entity}, nil, nil)
+	if err != nil {
+		t.Fatalf("The encrypted key can not be decrypted: %v", err)
+	}
+	if decrypted, _ := io.ReadAll(md.UnverifiedBody); string(decrypted) != privateKey {
+		t.Fatalf("The decrypted key is not the private key")
+	}
+}
+
+func TestEncryptKeyRecipients(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	entity, _ := openpgp.NewEntity("minion", "", "minion@domain.com", nil)
+
+	if _, err := EncryptKey("key", nil); err == nil {
+		t.Fatalf("Although no recipient provided, the function does not fail")
+	}
+	if _, err := EncryptKey("key", []string{identity.Recipient().String(), armoredPgpPublicKey(t, entity)}); err == nil {
+		t.Fatalf("Although age and PGP recipients provided, the function does not fail")
+	}
+	if _, err := EncryptKey("key", []string{"age1notakey"}); err == nil {
+		t.Fatalf("Although a bad recipient provided, the function does not fail")
+	}
+}
+
+func TestValidateKeyRecipient(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	entity, _ := openpgp.NewEntity("minion", "", "minion@domain.com", nil)
+
+	for _, recipient := range []string{identity.Recipient().String(), armoredPgpPublicKey(t, entity)} {
+		if err := ValidateKeyRecipient(recipient); err != nil {
+			t.Fatalf("The valid recipient %q is not accepted: %v", recipient, err)
+		}
+	}
+
+	for _, recipient := range []string{"", "age1notakey", identity.String(), pgpPublicKeyBlock + "\n-----END PGP PUBLIC KEY BLOCK-----"} {
+		if err := ValidateKeyRecipient(recipient); err == nil {
+			t.Fatalf("Although the bad recipient %q provided, the function does not fail", recipient)
+		}
+	}
+}
+
+func armoredPgpPublicKey(t *testing.T, entity *openpgp.Entity) string {
+	var out bytes.Buffer
+	w, err := pgparmor.Encode(&out, "PGP PUBLIC KEY BLOCK", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return out.String()
+}
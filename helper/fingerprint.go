@@ -0,0 +1,67 @@
+package helper
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// The hash types supported by the hash_type setting of the Salt Master.
+var SaltHashTypes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha224": sha256.New224,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// SaltFingerprint computes the fingerprint of a PEM key as Salt's `key.finger` and `salt-key -f` report it:
+// the hash of the non-empty lines between the PEM header and footer, newlines included.
+func SaltFingerprint(keyPem string, hashType string) (string, error) {
+	newHash, ok := SaltHashTypes[hashType]
+	if !ok {
+		return "", fmt.Errorf("unsupported hash type %s", hashType)
+	}
+
+	var lines []string
+	for _, line := range strings.SplitAfter(keyPem, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) < 3 {
+		return "", errors.New("failed to parse PEM block containing the key")
+	}
+
+	h := newHash()
+	h.Write([]byte(strings.Join(lines[1:len(lines)-1], "")))
+	return colonHex(h.Sum(nil)), nil
+}
+
+// Sha256Fingerprint computes the SHA256 fingerprint of the DER encoding of a PEM public key,
+// as `openssl pkey -pubin -outform DER | sha256sum` does.
+func Sha256Fingerprint(publicKeyPem string) (string, error) {
+	block, _ := pem.Decode([]byte(publicKeyPem))
+	if block == nil || !strings.Contains(block.Type, "PUBLIC KEY") {
+		return "", errors.New("failed to parse PEM block containing the public key")
+	}
+
+	sum := sha256.Sum256(block.Bytes)
+	return colonHex(sum[:]), nil
+}
+
+func colonHex(b []byte) string {
+	pairs := make([]string, len(b))
+	for i := range b {
+		pairs[i] = hex.EncodeToString(b[i : i+1])
+	}
+	return strings.Join(pairs, ":")
+}
@@ -0,0 +1,59 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+)
+
+const testPublicKey = `-----BEGIN PUBLIC KEY-----
+MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAuFC6W0sui0zi/NMmvqUf
+YwK9FcHhEOQZ189hAaN8TlcKGYn3o9357kFr5/iyQYMHbgQ/lhRew+gdy64Q85ja
+Wt8jVOAqN4+gs3bpQMrBPtM2e5/zspyuvn05n3gCmZAqwgSM62PjLJxN2eieaIMk
+VyY3GEGWKGPjXU+CUpXgf7+K/hXdJV1BFUFf7vJorfGywXqH9mf4YefiZu/rk47N
+2VO2RdVsqVywc11AbaF//NLi4pnnnzcrXBacvXOt9taUseo3RECCWhigWk/qxNFw
+0CEBsLolSlIv7qlyzf/Q4NVuTnLMRsRCFbxMF6aYCF0smQF0hk0L7R47dS63J7b8
+YQIDAQAB
+-----END PUBLIC KEY-----
+`
+
+func TestSaltFingerprint(t *testing.T) {
+	// As reported by `salt-key -f` with each hash_type of the Salt Master
+	expected := map[string]string{
+		"md5":    "62:b9:e7:ea:91:a4:dd:ae:03:cf:8c:bd:27:8f:06:fe",
+		"sha1":   "c7:5a:c9:cb:e8:bc:0a:f2:e9:c1:46:51:ad:90:b4:72:15:d0:f1:63",
+		"sha256": "fc:33:61:a0:bd:33:cd:6c:69:fd:e5:c5:42:48:e8:f2:d9:68:5e:d0:fb:9c:16:c3:95:71:8d:ef:60:90:b3:ac",
+		"sha512": "cc:9e:0e:a9:5b:de:f8:b1:f8:d6:5f:3b:73:5d:ea:9f:e0:82:38:ca:20:24:a7:fa:cd:83:7e:0a:a0:c6:75:2e:f8:d3:c4:4c:42:51:9f:49:67:35:c8:96:91:dc:da:e6:b6:34:bf:64:bf:88:7d:55:d1:9b:04:21:e2:7d:7f:21",
+	}
+
+	for hashType, fingerprint := range expected {
+		if actual, err := SaltFingerprint(testPublicKey, hashType); err != nil || actual != fingerprint {
+			t.Fatalf("The %s fingerprint is %s instead of %s: %v", hashType, actual, fingerprint, err)
+		}
+	}
+
+	// Salt ignores the blank lines and the missing trailing newline is part of the footer
+	if actual, _ := SaltFingerprint("\n"+strings.TrimSpace(testPublicKey), "sha256"); actual != expected["sha256"] {
+		t.Fatalf("The fingerprint depends on the surrounding whitespace")
+	}
+
+	if _, err := SaltFingerprint(testPublicKey, "crc32"); err == nil {
+		t.Fatalf("The function should fail with an unsupported hash type")
+	}
+	if _, err := SaltFingerprint("not a key", "sha256"); err == nil {
+		t.Fatalf("The function should fail when the key is not in PEM format")
+	}
+}
+
+func TestSha256Fingerprint(t *testing.T) {
+	fingerprint, err := Sha256Fingerprint(testPublicKey)
+	if err != nil {
+		t.Fatalf("The function fails: %v", err)
+	}
+	if expected := "69:08:54:27:4a:56:83:fc:84:bb:fe:3f:ab:f7:76:14:7c:13:a9:2e:a5:c1:a7:a3:ae:7b:af:38:7d:19:51:9f"; fingerprint != expected {
+		t.Fatalf("The fingerprint is %s instead of %s", fingerprint, expected)
+	}
+
+	if _, err := Sha256Fingerprint("not a key"); err == nil {
+		t.Fatalf("The function should fail when the key is not in PEM format")
+	}
+}
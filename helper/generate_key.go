@@ -0,0 +1,34 @@
+package helper
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+)
+
+// Salt rounds smaller key sizes up to this one.
+const MinimumRsaKeySize = 2048
+
+// GenerateRsaKeyPair generates an RSA key pair in the PEM formats Salt uses for minion keys:
+// PKCS#1 for the private key and PKIX for the public key.
+func GenerateRsaKeyPair(keySize int) (string, string, error) {
+	if keySize < MinimumRsaKeySize {
+		keySize = MinimumRsaKeySize
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		return "", "", err
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	privateKeyPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	publicKeyPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})
+
+	return string(privateKeyPem), string(publicKeyPem), nil
+}
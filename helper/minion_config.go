@@ -0,0 +1,226 @@
+package helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The default directories of the configuration of the minions, by platform.
+var MinionConfigDirs = map[string]string{
+	"linux":   "/etc/salt",
+	"windows": `C:\ProgramData\Salt Project\Salt\conf`,
+}
+
+// The settings of the minion configuration set by the fields of MinionConfig rather than by its Options.
+var MinionConfigSettings = []string{"id", "master", "master_port", "master_finger"}
+
+// MinionConfig is the configuration a minion needs to connect to the Salt Master with a key pair
+// generated beforehand.
+type MinionConfig struct {
+	MinionId     string
+	Masters      []string
+	MasterPort   int
+	MasterFinger string
+	PrivateKey   string
+	PublicKey    string
+	// Other settings of the minion. The values are strings, booleans or integers, and keep their type
+	// in YAML: a string which YAML would read as another type, e.g. `true`, `0644` or `null`, is quoted.
+	Options map[string]any
+	// The platform of the minion, `linux` or `windows`.
+	Platform string
+	// The directory of the configuration of the minion, the default one of the platform if empty.
+	ConfigDir string
+}
+
+// plainScalar matches the strings which YAML reads as strings when they are not quoted. The strings
+// starting with a digit are excluded, as YAML 1.1 reads e.g. `0644`, `1_000`, `12:34` and `2006-01-02`
+// as numbers or timestamps, and so are the words of yamlKeywords.
+var plainScalar = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_./@+-]*$`)
+
+// yamlKeywords are the plain scalars which YAML 1.1 or 1.2 reads as booleans or null, whatever their case.
+var yamlKeywords = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true, "y": true, "n": true,
+	"null": true,
+}
+
+// optionName matches the names of the settings of Salt.
+var optionName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// yamlString quotes a string for YAML. Double quoted YAML strings are a superset of JSON strings.
+func yamlString(value string) string {
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// yamlValue renders an option as a YAML scalar of the same type. A string is rendered as a plain
+// scalar when YAML reads it as a string, and quoted otherwise.
+func yamlValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		if plainScalar.MatchString(v) && !yamlKeywords[strings.ToLower(v)] {
+			return v
+		}
+		return yamlString(v)
+	default:
+		// The booleans and integers
+		return fmt.Sprint(v)
+	}
+}
+
+// yamlBlock renders a multiline string as a YAML literal block scalar indented by indent spaces.
+func yamlBlock(value string, indent int) string {
+	var b strings.Builder
+	if strings.HasSuffix(value, "\n") {
+		b.WriteString("|\n")
+	} else {
+		b.WriteString("|-\n")
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(value, "\n"), "\n") {
+		if line != "" {
+			b.WriteString(strings.Repeat(" ", indent))
+			b.WriteString(line)
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (c MinionConfig) windows() bool {
+	return c.Platform == "windows"
+}
+
+// path joins the configuration directory of the minion with a relative path, with the separator of
+// its platform.
+func (c MinionConfig) path(elem ...string) string {
+	dir := c.ConfigDir
+	if dir == "" {
+		dir = MinionConfigDirs[c.Platform]
+	}
+	separator := "/"
+	if c.windows() {
+		separator = `\`
+	}
+	return strings.TrimRight(dir, `/\`) + separator + strings.Join(elem, separator)
+}
+
+// Validate checks the fields of the configuration which Render can not render.
+func (c MinionConfig) Validate() error {
+	if err := ValidateMinionId(c.MinionId); err != nil {
+		return err
+	}
+	if len(c.Masters) == 0 {
+		return fmt.Errorf("at least one master is required")
+	}
+	for _, master := range c.Masters {
+		if master == "" {
+			return fmt.Errorf("the address of a master is empty")
+		}
+	}
+	if _, ok := MinionConfigDirs[c.Platform]; !ok {
+		return fmt.Errorf("unsupported platform %s", c.Platform)
+	}
+	if (c.PrivateKey == "") != (c.PublicKey == "") {
+		return fmt.Errorf("the private key and the public key must be set together")
+	}
+	for name, value := range c.Options {
+		if !optionName.MatchString(name) {
+			return fmt.Errorf("the option %s is not a setting name, which only has lowercase letters, digits and underscores", name)
+		}
+		switch value.(type) {
+		case string, bool, int:
+		default:
+			return fmt.Errorf("the option %s is a %T, only strings, booleans and integers are supported", name, value)
+		}
+		for _, setting := range MinionConfigSettings {
+			if name == setting {
+				return fmt.Errorf("the option %s can not be set, it is rendered from its own field", name)
+			}
+		}
+	}
+	return nil
+}
+
+// Render renders the configuration of the minion as a YAML file of its `minion.d` directory.
+func (c MinionConfig) Render() string {
+	var b strings.Builder
+	b.WriteString("# Managed by Terraform\n")
+	fmt.Fprintf(&b, "id: %s\n", yamlString(c.MinionId))
+	if len(c.Masters) == 1 {
+		fmt.Fprintf(&b, "master: %s\n", yamlString(c.Masters[0]))
+	} else {
+		b.WriteString("master:\n")
+		for _, master := range c.Masters {
+			fmt.Fprintf(&b, "  - %s\n", yamlString(master))
+		}
+	}
+	if c.MasterPort != 0 {
+		fmt.Fprintf(&b, "master_port: %d\n", c.MasterPort)
+	}
+	if c.MasterFinger != "" {
+		fmt.Fprintf(&b, "master_finger: %s\n", yamlString(c.MasterFinger))
+	}
+
+	names := make([]string, 0, len(c.Options))
+	for name := range c.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s: %s\n", name, yamlValue(c.Options[name]))
+	}
+
+	return b.String()
+}
+
+// RenderCloudInit renders a cloud-config document which writes the ID, the key pair and the
+// configuration of the minion, then restarts it. The Windows variant, for cloudbase-init, uses the
+// paths of Windows and PowerShell, and leaves the permissions of the files to their directory.
+func (c MinionConfig) RenderCloudInit() string {
+	type file struct {
+		path        string
+		content     string
+		permissions string
+	}
+	files := []file{
+		{c.path("minion_id"), c.MinionId, "0644"},
+	}
+	if c.PrivateKey != "" {
+		files = append(files,
+			file{c.path("pki", "minion", "minion.pem"), c.PrivateKey, "0400"},
+			file{c.path("pki", "minion", "minion.pub"), c.PublicKey, "0644"},
+		)
+	}
+	files = append(files, file{c.path("minion.d", "terraform.conf"), c.Render(), "0644"})
+
+	var b strings.Builder
+	b.WriteString("#cloud-config\n")
+	b.WriteString("write_files:\n")
+	for _, f := range files {
+		fmt.Fprintf(&b, "  - path: %s\n", yamlString(f.path))
+		if strings.Contains(f.content, "\n") {
+			fmt.Fprintf(&b, "    content: %s\n", yamlBlock(f.content, 6))
+		} else {
+			fmt.Fprintf(&b, "    content: %s\n", yamlString(f.content))
+		}
+		if !c.windows() {
+			b.WriteString("    owner: root:root\n")
+			fmt.Fprintf(&b, "    permissions: %s\n", yamlString(f.permissions))
+		}
+	}
+
+	b.WriteString("runcmd:\n")
+	if c.windows() {
+		fmt.Fprintf(&b, "  - %s\n", yamlString("powershell.exe -NoProfile -Command \"Set-Service salt-minion -StartupType Automatic; Restart-Service salt-minion\""))
+	} else {
+		b.WriteString("  - [systemctl, enable, salt-minion]\n")
+		b.WriteString("  - [systemctl, restart, salt-minion]\n")
+	}
+
+	return b.String()
+}
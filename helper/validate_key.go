@@ -4,18 +4,24 @@ import (
 	"errors"
 	"strings"
 
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 )
 
 func ValidateRsaPrivateKey(privateKeyPem string) error {
-	block, _ := pem.Decode([]byte(privateKeyPem))
+	_, err := ParseRsaPrivateKey(privateKeyPem)
+	return err
+}
+
+func ValidateRsaPublicKey(publicKeyPem string) error {
+	block, _ := pem.Decode([]byte(publicKeyPem))
 
-	if block == nil || !strings.Contains(block.Type, "PRIVATE KEY") {
-		return errors.New("failed to parse PEM block containing the private key")
+	if block == nil || !strings.Contains(block.Type, "PUBLIC KEY") {
+		return errors.New("failed to parse PEM block containing the public key")
 	}
 
-	_, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	_, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
 		return err
 	}
@@ -23,17 +29,23 @@ func ValidateRsaPrivateKey(privateKeyPem string) error {
 	return nil
 }
 
-func ValidateRsaPublicKey(publicKeyPem string) error {
+// RsaPublicKeySize returns the size in bits of the modulus of a PEM RSA public key.
+func RsaPublicKeySize(publicKeyPem string) (int, error) {
 	block, _ := pem.Decode([]byte(publicKeyPem))
 
 	if block == nil || !strings.Contains(block.Type, "PUBLIC KEY") {
-		return errors.New("failed to parse PEM block containing the public key")
+		return 0, errors.New("failed to parse PEM block containing the public key")
 	}
 
-	_, err := x509.ParsePKIXPublicKey(block.Bytes)
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return 0, errors.New("the public key is not an RSA key")
+	}
+
+	return rsaKey.N.BitLen(), nil
 }
@@ -35,3 +35,24 @@ func TestValidateRsaPublicKeyFailed(t *testing.T) {
 		t.Fatalf("Failed: although the bad public key provided, the function does not fail")
 	}
 }
+
+func TestRsaPublicKeySize(t *testing.T) {
+	publicKey := "-----BEGIN PUBLIC KEY-----\nMIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAsdZVUMlKo9X/A3Uyttch\nFrxYnBiyi3R/DhzuUW5A1gamQwkQW5DG/hPfJE4+yuH9f4k7H+0mzCqHNgjhXndZ\n6sL+l3SO4+nu9QMi91oNZ4NIQagUuC1js4Va8t8/LKuW20nUklX8B6tnYAc0m4bj\nGDlYvLmG7vjUbmv2jnnDkYSxBYrIUCWODXhtzP9Uh2o3V8ggZusUbnFr1YBLRKaT\nvuTTiJdRVJC+gLYloyJ1EA4hXK/o0r1VmFv6z8GlOxd8T1zKLjNQY76u8eELIIU9\nPhOFV2uv7ipweyfWVCjBaiEdMcWBWRz9IhCutrXp7zuUW2WM3yi+HY6T4DgOGsdZ\nQQIDAQAB\n-----END PUBLIC KEY-----"
+	size, err := RsaPublicKeySize(publicKey)
+	if err != nil || size != 2048 {
+		t.Fatalf("The function returns the size %d instead of 2048: %v", size, err)
+	}
+
+	if _, err := RsaPublicKeySize("not a key"); err == nil {
+		t.Fatalf("Although a bad public key provided, the function does not fail")
+	}
+}
+
+func TestValidateRsaPrivateKeyPkcs8(t *testing.T) {
+	privateKey, _, _ := GenerateRsaKeyPair(2048)
+	pkcs8, _ := PrivateKeyToPkcs8(privateKey)
+
+	if err := ValidateRsaPrivateKey(pkcs8); err != nil {
+		t.Fatalf("The function doesn't succeed with a PKCS#8 private key provided: %v", err)
+	}
+}
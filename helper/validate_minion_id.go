@@ -0,0 +1,8 @@
+package helper
+
+import "github.com/imperva/terraform-provider-saltstack/pkg/minionid"
+
+// ValidateMinionId checks a minion ID against the rules of Salt, and rejects commas like the provider does.
+func ValidateMinionId(minionId string) error {
+	return minionid.Validate(minionId)
+}
@@ -0,0 +1,43 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateMinionId(t *testing.T) {
+	cases := []struct {
+		name     string
+		minionId string
+		valid    bool
+	}{
+		{"hostname", "web-1.domain.com", true},
+		{"underscore", "web_1.domain.com", true},
+		{"upper case", "Web-1.Domain.com", true},
+		{"long label", strings.Repeat("a", 64) + ".domain.com", true},
+		{"glob characters", "web-[1]*?", true},
+		{"unicode", "wéb-1", true},
+		{"max length", strings.Repeat("a", 255), true},
+		{"empty", "", false},
+		{"dot", ".", false},
+		{"dot dot", "..", false},
+		{"too long", strings.Repeat("a", 256), false},
+		{"slash", "web/1", false},
+		{"path traversal", "../minions/web-1", false},
+		{"backslash", "web\\1", false},
+		{"nul", "web\x001", false},
+		{"comma", "web-1,web-2", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateMinionId(c.minionId)
+			if c.valid && err != nil {
+				t.Fatalf("The minion ID %q is valid, but the function fails: %v", c.minionId, err)
+			}
+			if !c.valid && err == nil {
+				t.Fatalf("The minion ID %q is not valid, but the function does not fail", c.minionId)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"log"
+
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/plugin"
 
@@ -11,6 +14,18 @@ import (
 //go:generate go run github.com/hashicorp/terraform-plugin-docs/cmd/tfplugindocs
 
 func main() {
+	ctx := context.Background()
+
+	shutdownTracing, err := saltstack.SetupTracing(ctx)
+	if err != nil {
+		log.Printf("[WARN] Unable to set up OpenTelemetry tracing: %v", err)
+	}
+	defer func() {
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("[WARN] Unable to flush OpenTelemetry spans: %v", err)
+		}
+	}()
+
 	plugin.Serve(&plugin.ServeOpts{
 		ProviderFunc: func() *schema.Provider {
 			return saltstack.Provider()
@@ -0,0 +1,84 @@
+// Package fnmatch matches minion IDs against globs the way Salt does, with the `fnmatch` module of
+// Python, which differs from path.Match:
+//
+//   - `*` and `?` also match `/`;
+//   - `[!...]` negates a set, while `[^...]` matches `^` literally;
+//   - `\` is a literal character, not an escape;
+//   - a `[` without a closing `]` is a literal character, not an error.
+//
+// A set with a reversed range, e.g. `[z-a]`, is an error: Python fails on it before 3.9, and matches nothing
+// with it since.
+package fnmatch
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Compile translates a glob into the regular expression `fnmatch.translate` builds.
+func Compile(pattern string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString(`(?s)\A`)
+
+	glob := []rune(pattern)
+	for i := 0; i < len(glob); {
+		r := glob[i]
+		i++
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		case '[':
+			j := i
+			if j < len(glob) && glob[j] == '!' {
+				j++
+			}
+			if j < len(glob) && glob[j] == ']' {
+				j++
+			}
+			for j < len(glob) && glob[j] != ']' {
+				j++
+			}
+			if j >= len(glob) {
+				expr.WriteString(`\[`)
+				continue
+			}
+			set := glob[i:j]
+			i = j + 1
+
+			expr.WriteString("[")
+			if set[0] == '!' {
+				expr.WriteString("^")
+				set = set[1:]
+			}
+			for _, c := range set {
+				if c == '-' {
+					expr.WriteRune(c)
+				} else {
+					expr.WriteString(regexp.QuoteMeta(string(c)))
+				}
+			}
+			expr.WriteString("]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString(`\z`)
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("the glob %q is not valid: %v", pattern, err)
+	}
+	return re, nil
+}
+
+// Match tells whether a name matches a glob, as `fnmatch.fnmatchcase` does.
+func Match(pattern string, name string) (bool, error) {
+	re, err := Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(name), nil
+}
@@ -0,0 +1,66 @@
+package fnmatch
+
+import (
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMatch checks the globs whose results differ from path.Match against the results of Python's
+// fnmatch.fnmatchcase.
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		matched bool
+		// Whether path.Match gives another result, or fails
+		differs bool
+	}{
+		{"web-*", "web-1.domain.com", true, false},
+		{"web-?", "web-1", true, false},
+		{"web-[0-9]", "web-1", true, false},
+		{"web-[0-9]", "web-a", false, false},
+		{"*", "", true, false},
+		{"*", "web/1", true, true},
+		{"web?1", "web/1", true, true},
+		{"web-[!0-9]", "web-a", true, true},
+		{"web-[!0-9]", "web-1", false, true},
+		{"web-[^0-9]", "web-a", false, true},
+		{"web-[^0-9]", "web-^", true, false},
+		{"web-[^0-9]", "web-1", true, true},
+		{`web\*`, `web\1`, true, true},
+		{`web\*`, "web*", false, true},
+		{`web-[\]`, `web-\`, true, true},
+		{"web-[1", "web-[1", true, true},
+		{"web-[", "web-[", true, true},
+		{"web-[]", "web-[]", true, true},
+		{"web-[]]", "web-]", true, true},
+		{"web-[!]]", "web-1", true, true},
+		{"web-[!]]", "web-]", false, false},
+		{"web-[]-]", "web--", true, true},
+		{"web-[a-]", "web--", true, true},
+		{"web-[[]", "web-[", true, false},
+		{"web-[[:alpha:]]", "web-a]", true, false},
+		{"web-[*]", "web-*", true, false},
+		{"web-[*]", "web-1", false, false},
+		{"web.1", "webx1", false, false},
+		{"web-(1|2)", "web-(1|2)", true, false},
+		{"WEB-*", "web-1", false, false},
+		{"web-1", "web-1\n", false, false},
+		{"web-*", "web-1\nweb-2", true, false},
+	}
+	for _, test := range tests {
+		matched, err := Match(test.pattern, test.name)
+		assert.NoError(t, err, test.pattern)
+		assert.Equal(t, test.matched, matched, "fnmatch(%q, %q)", test.name, test.pattern)
+
+		pathMatched, pathErr := path.Match(test.pattern, test.name)
+		assert.Equal(t, test.differs, pathErr != nil || pathMatched != test.matched, "path.Match(%q, %q)", test.pattern, test.name)
+	}
+}
+
+func TestMatchInvalid(t *testing.T) {
+	_, err := Match("web-[9-0]", "web-1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,38 @@
+// Package minionid checks minion IDs before they are passed to Salt. It has no dependencies, so that both
+// the salt-api client and the helpers of the provider can use it.
+package minionid
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The longest file name most filesystems accept, as the key of a minion is stored in a file named after its ID.
+const maxLength = 255
+
+// Validate checks a minion ID against the rules of Salt's `valid_id`. The ID names the key file of the
+// minion in the PKI directory of the Salt Master, so it must not be empty, `.` or `..`, nor contain `/`,
+// `\` or NUL characters, and must fit in a file name. Salt accepts any other character, e.g. underscores,
+// upper case letters and labels longer than the 63 characters of a hostname.
+//
+// Commas are rejected as well, although Salt accepts them: this is a restriction of the provider, as the
+// key functions of Salt split their match on them, so such a key could not be managed on its own.
+func Validate(minionId string) error {
+	switch {
+	case minionId == "":
+		return errors.New("the minion ID is empty")
+	case minionId == "." || minionId == "..":
+		return fmt.Errorf("the minion ID %q is a relative path", minionId)
+	case len(minionId) > maxLength:
+		return fmt.Errorf("the minion ID is %d bytes long, the maximum is %d", len(minionId), maxLength)
+	}
+
+	if i := strings.IndexAny(minionId, "/\\\x00"); i >= 0 {
+		return fmt.Errorf("the minion ID %q contains the forbidden character %q", minionId, minionId[i])
+	}
+	if strings.Contains(minionId, ",") {
+		return fmt.Errorf("the minion ID %q contains a comma, which the provider forbids as the key functions of Salt split their match on it", minionId)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package saltapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// WheelResult is the result of a wheel function as returned by salt-api.
+type WheelResult struct {
+	Tag  string `json:"tag"`
+	Data struct {
+		Fun     string          `json:"fun"`
+		Jid     string          `json:"jid"`
+		User    string          `json:"user"`
+		Success *bool           `json:"success"`
+		Return  json.RawMessage `json:"return"`
+	} `json:"data"`
+}
+
+type wheelReadResult struct {
+	Return []WheelResult `json:"return"`
+}
+
+type readResult struct {
+	Return []json.RawMessage `json:"return"`
+}
+
+// Wheel executes a wheel function, e.g. `key.list_all`, on the Salt Master and decodes
+// its return into ret, unless ret is nil.
+func (c *Client) Wheel(ctx context.Context, fun string, kwargs map[string]interface{}, ret interface{}) error {
+	resp, err := c.PostWithContext(ctx, "/run", lowstate("wheel", fun, nil, kwargs))
+	if err != nil {
+		return err
+	}
+
+	var rd wheelReadResult
+	if err := parseResponseBody(resp, &rd); err != nil {
+		return err
+	}
+
+	if len(rd.Return) == 0 {
+		return &FunctionError{Client: "wheel", Fun: fun, Message: "empty return from API"}
+	}
+
+	data := rd.Return[0].Data
+	if data.Success != nil && !*data.Success {
+		return &FunctionError{Client: "wheel", Fun: fun, Message: returnMessage(data.Return)}
+	}
+
+	return decodeReturn("wheel", fun, data.Return, ret)
+}
+
+// Runner executes a runner function, e.g. `jobs.active`, on the Salt Master and decodes
+// its return into ret, unless ret is nil.
+func (c *Client) Runner(ctx context.Context, fun string, args []interface{}, kwargs map[string]interface{}, ret interface{}) error {
+	resp, err := c.PostWithContext(ctx, "/run", lowstate("runner", fun, args, kwargs))
+	if err != nil {
+		return err
+	}
+
+	var rd readResult
+	if err := parseResponseBody(resp, &rd); err != nil {
+		return err
+	}
+
+	if len(rd.Return) == 0 {
+		return &FunctionError{Client: "runner", Fun: fun, Message: "empty return from API"}
+	}
+
+	return decodeReturn("runner", fun, rd.Return[0], ret)
+}
+
+// Local executes an execution module function, e.g. `test.ping`, on the targeted minions and
+// decodes the returns, keyed by minion ID, into ret, unless ret is nil.
+// Minions which do not answer are missing from the returns.
+func (c *Client) Local(ctx context.Context, tgt string, tgtType string, fun string, args []interface{}, kwargs map[string]interface{}, ret interface{}) error {
+	low := lowstate("local", fun, args, kwargs)
+	low["tgt"] = tgt
+	if tgtType != "" {
+		low["tgt_type"] = tgtType
+	}
+
+	resp, err := c.PostWithContext(ctx, "/run", low)
+	if err != nil {
+		return err
+	}
+
+	var rd readResult
+	if err := parseResponseBody(resp, &rd); err != nil {
+		return err
+	}
+
+	if len(rd.Return) == 0 {
+		return &FunctionError{Client: "local", Fun: fun, Message: "empty return from API"}
+	}
+
+	return decodeReturn("local", fun, rd.Return[0], ret)
+}
+
+func lowstate(client string, fun string, args []interface{}, kwargs map[string]interface{}) map[string]interface{} {
+	low := map[string]interface{}{
+		"client": client,
+		"fun":    fun,
+	}
+	if len(args) > 0 {
+		low["arg"] = args
+	}
+	for k, v := range kwargs {
+		low[k] = v
+	}
+	return low
+}
+
+// decodeReturn decodes the return of a function. Salt reports exceptions of the runner
+// and wheel functions as a string return, which is turned into a FunctionError.
+func decodeReturn(client string, fun string, data json.RawMessage, ret interface{}) error {
+	var message string
+	if json.Unmarshal(data, &message) == nil && strings.HasPrefix(message, "Exception occurred in") {
+		return &FunctionError{Client: client, Fun: fun, Message: message}
+	}
+
+	if ret == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(data, ret); err != nil {
+		if message != "" {
+			return &FunctionError{Client: client, Fun: fun, Message: message}
+		}
+		return fmt.Errorf("unexpected return of %s function %s: %w", client, fun, err)
+	}
+
+	return nil
+}
+
+func returnMessage(data json.RawMessage) string {
+	var message string
+	if json.Unmarshal(data, &message) == nil {
+		return message
+	}
+	return string(data)
+}
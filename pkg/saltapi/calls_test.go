@@ -0,0 +1,177 @@
+package saltapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi/saltapitest"
+	"github.com/stretchr/testify/assert"
+)
+
+func testClient(t *testing.T, s *saltapitest.Server) *Client {
+	client, err := NewClient(Config{
+		Host:     s.Host(),
+		Port:     s.Port(),
+		Scheme:   "http",
+		Username: s.Username,
+		Password: s.Password,
+		Eauth:    s.Eauth,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestClientWheel(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	server.SetKey(saltapitest.Pending, "minion", "pub")
+	client := testClient(t, server)
+	ctx := context.Background()
+
+	keys, err := client.KeyListAll(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"minion"}, keys[KeyPending])
+
+	server.Handle("wheel", "key.list_all", func(s *saltapitest.Server, low saltapitest.Lowstate) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	_, err = client.KeyListAll(ctx)
+	var functionError *FunctionError
+	assert.True(t, errors.As(err, &functionError))
+	assert.Equal(t, "key.list_all", functionError.Fun)
+	assert.Contains(t, functionError.Message, "boom")
+}
+
+func TestClientKeyGenAccept(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	client := testClient(t, server)
+	ctx := context.Background()
+
+	keyPair, err := client.KeyGenAccept(ctx, "minion", 2048, false)
+	assert.NoError(t, err)
+	assert.Contains(t, keyPair.Public, "PUBLIC KEY")
+
+	_, err = client.KeyGenAccept(ctx, "minion", 2048, false)
+	assert.ErrorIs(t, err, ErrKeyExists)
+
+	rotated, err := client.KeyGenAccept(ctx, "minion", 2048, true)
+	assert.NoError(t, err)
+	assert.NotEqual(t, keyPair.Public, rotated.Public)
+}
+
+func TestClientRunner(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	client := testClient(t, server)
+
+	var version string
+	err := client.Runner(context.Background(), "salt.cmd", []interface{}{"test.version"}, nil, &version)
+	assert.NoError(t, err)
+	assert.Equal(t, "3004.2", version)
+
+	err = client.Runner(context.Background(), "salt.cmd", []interface{}{"test.unknown"}, nil, &version)
+	var functionError *FunctionError
+	assert.True(t, errors.As(err, &functionError))
+}
+
+func TestClientLocal(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	server.Perms = append(server.Perms, ".*")
+	server.Handle("local", "test.ping", func(s *saltapitest.Server, low saltapitest.Lowstate) (interface{}, error) {
+		return map[string]bool{low["tgt"].(string): true}, nil
+	})
+	client := testClient(t, server)
+
+	var ret map[string]bool
+	err := client.Local(context.Background(), "minion", "glob", "test.ping", nil, nil, &ret)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"minion": true}, ret)
+}
+
+func TestClientAPIError(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	server.Perms = nil
+	client := testClient(t, server)
+
+	_, err := client.KeyListAll(context.Background())
+	var apiError *APIError
+	assert.True(t, errors.As(err, &apiError))
+	assert.Equal(t, 401, apiError.StatusCode)
+	assert.Equal(t, "401 Unauthorized", err.Error())
+	assert.Contains(t, apiError.Body, "No permission")
+}
+
+func TestClientKeyMinionsExactMatch(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	for _, id := range []string{"web-1", "web-10", "web-*", "web-[1]"} {
+		server.SetKey(saltapitest.Accepted, id, "pub-"+id)
+	}
+	_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+	server.SetKey(saltapitest.Pending, "web-?", publicKey)
+	client := testClient(t, server)
+	ctx := context.Background()
+
+	keys, err := client.KeyPrintMinions(ctx, []string{"web-*", "web-[1]"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]string{KeyAccepted: {"web-*": "pub-web-*", "web-[1]": "pub-web-[1]"}}, keys)
+
+	fingers, err := client.KeyFingerMinion(ctx, "web-?", "")
+	assert.NoError(t, err)
+	assert.Len(t, fingers, 1)
+	assert.Contains(t, fingers[KeyPending], "web-?")
+
+	rejected, err := client.KeyRejectMinions(ctx, KeyAccepted, []string{"web-[1]", "web-?", "web-2"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{KeyAccepted: {"web-[1]"}}, rejected)
+
+	rejected, err = client.KeyRejectMinions(ctx, KeyPending, []string{"web-[1]", "web-?", "web-2"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{KeyPending: {"web-?"}}, rejected)
+
+	deleted, err := client.KeyDeleteMinions(ctx, []string{"web-*", "web-[1]"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{KeyAccepted: {"web-*"}, KeyRejected: {"web-[1]"}}, deleted)
+
+	all, err := client.KeyListAll(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"web-1", "web-10"}, all[KeyAccepted])
+	assert.Equal(t, []string{"web-?"}, all[KeyRejected])
+
+	_, err = client.KeyPrintMinions(ctx, []string{"web-1,web-10"})
+	assert.ErrorContains(t, err, "can not be matched")
+	for _, call := range server.CallsTo("wheel", "key.delete") {
+		t.Errorf("The keys were deleted by glob: %v", call)
+	}
+}
+
+func TestClientKeyAcceptMinionsOneBucket(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	_, pendingKey, _ := saltapitest.GenerateKeyPair(2048)
+	_, deniedKey, _ := saltapitest.GenerateKeyPair(2048)
+	server.SetKey(saltapitest.Pending, "web-1", pendingKey)
+	server.AddKey(saltapitest.Denied, "web-1", deniedKey)
+	client := testClient(t, server)
+	ctx := context.Background()
+
+	accepted, err := client.KeyAcceptMinions(ctx, KeyPending, []string{"web-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{KeyPending: {"web-1"}}, accepted)
+
+	// The denied key does not overwrite the accepted one
+	keys, err := client.KeyPrintMinions(ctx, []string{"web-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]string{KeyAccepted: {"web-1": pendingKey}, KeyDenied: {"web-1": deniedKey}}, keys)
+
+	calls := server.CallsTo("wheel", "key.accept_dict")
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, map[string]interface{}{KeyPending: []interface{}{"web-1"}}, calls[0]["match"])
+		assert.Equal(t, false, calls[0]["include_rejected"])
+		assert.Equal(t, false, calls[0]["include_denied"])
+	}
+
+	_, err = client.KeyAcceptMinions(ctx, KeyAccepted, []string{"web-1"})
+	assert.ErrorContains(t, err, "can not be accepted")
+	_, err = client.KeyRejectMinions(ctx, KeyRejected, []string{"web-1"})
+	assert.ErrorContains(t, err, "can not be rejected")
+}
@@ -0,0 +1,316 @@
+// Package saltapi is a client of the Salt Master REST API (salt-api with rest_cherrypy).
+//
+// It handles the eauth and token authentication and offers typed calls to the wheel,
+// runner and local clients of salt-api.
+package saltapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"crypto/tls"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Config struct {
+	Host          string `validate:"required"`
+	Port          int
+	Username      string `validate:"required_if=UseToken false"`
+	Password      string `validate:"required_if=UseToken false"`
+	Debug         bool
+	SSLSkipVerify bool
+	Eauth         string
+	Scheme        string
+	UseToken      bool
+	Token         string `validate:"required_if=UseToken true"`
+	SaltVersion   string
+	// The pki_dir of the Salt Master, defaults to /etc/salt/pki/master.
+	PKIDir string
+	// How many times a call is retried when salt-api can not be reached, or answers 502 or 503. The
+	// requests which may have reached salt-api are never retried, as the key functions are not idempotent.
+	MaxRetries int
+	// The wait before the first retry, which doubles at each retry. Defaults to 1 second.
+	RetryWait time.Duration
+}
+
+type Client struct {
+	Config       Config
+	Client       *http.Client
+	sessionToken string
+	sessionMu    sync.Mutex
+
+	versionMu sync.Mutex
+	version   *SaltVersion
+}
+
+type LoginReadResult struct {
+	Return []struct {
+		Token  string   `json:"token"`
+		Expire float64  `json:"expire"`
+		Start  float64  `json:"start"`
+		User   string   `json:"user"`
+		Eauth  string   `json:"eauth"`
+		Perms  []string `json:"perms"`
+	} `json:"return"`
+}
+
+func NewClient(config Config) (*Client, error) {
+	supportedAuthTypesKeys := [...]string{"pam", "sharedsecret"}
+
+	supportedAuthTypes := map[string]bool{}
+	for _, t := range supportedAuthTypesKeys {
+		supportedAuthTypes[t] = true
+	}
+
+	if !supportedAuthTypes[config.Eauth] {
+		return nil, fmt.Errorf("the Eauth type %s is not supported. The valid types are: %v", config.Eauth, strings.Join(supportedAuthTypesKeys[:], ", "))
+	}
+
+	if config.Port == 0 {
+		config.Port = 8000
+	}
+
+	if config.Scheme == "" {
+		config.Scheme = "https"
+	}
+
+	if config.PKIDir == "" {
+		config.PKIDir = "/etc/salt/pki/master"
+	}
+
+	if config.RetryWait == 0 {
+		config.RetryWait = time.Second
+	}
+
+	validate := validator.New()
+	err := validate.Struct(config)
+	if err != nil {
+		return nil, err.(validator.ValidationErrors)
+	}
+
+	c := Client{Config: config}
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: config.SSLSkipVerify,
+		},
+	}
+	transport, err := NewRecorderFromEnv(tr)
+	if err != nil {
+		return nil, err
+	}
+	c.Client = &http.Client{Timeout: 60 * time.Second, Transport: transport}
+
+	return &c, nil
+}
+
+func (c *Client) Login() error {
+	return c.LoginWithContext(context.Background())
+}
+
+func (c *Client) LoginWithContext(ctx context.Context) (err error) {
+	ctx, span := tracer().Start(ctx, "salt-api /login", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { endSpan(span, err) }()
+
+	if c.sessionToken != "" {
+		// We are already logged in and already have a session token
+		return nil
+	}
+
+	if c.Config.UseToken {
+		return fmt.Errorf("Unable to login when configured to use a token. Should configure username/password when trying to login")
+	}
+
+	reqData := map[string]interface{}{
+		"username": c.Config.Username,
+		"password": c.Config.Password,
+		"eauth":    c.Config.Eauth,
+	}
+
+	reqBody, err := convertToJSONString(reqData)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s://%s:%s/login", c.Config.Scheme, c.Config.Host, strconv.Itoa(c.Config.Port))
+	resp, err := c.do(ctx, span, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer([]byte(reqBody)))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	if resp.StatusCode != 200 {
+		return newAPIError(resp)
+	}
+
+	var rd LoginReadResult
+	err = parseResponseBody(resp, &rd)
+	if err != nil {
+		return err
+	}
+
+	if len(rd.Return) == 0 {
+		return fmt.Errorf("Empty return from API while trying to login")
+	}
+	c.sessionToken = rd.Return[0].Token
+	return nil
+}
+
+func (c *Client) getSessionToken(ctx context.Context) (string, error) {
+	// The client is shared by the resources and the workers of the bulk resources
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+
+	if c.sessionToken == "" {
+		// We need to login
+		if err := c.LoginWithContext(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	return c.sessionToken, nil
+}
+
+func (c *Client) Post(uri string, data map[string]interface{}) (*http.Response, error) {
+	return c.PostWithContext(context.Background(), uri, data)
+}
+
+func (c *Client) PostWithContext(ctx context.Context, uri string, data map[string]interface{}) (resp *http.Response, err error) {
+	ctx, span := tracer().Start(ctx, "salt-api "+uri, trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { endSpan(span, err) }()
+	span.SetAttributes(lowstateAttributes(data)...)
+
+	reqData := make(map[string]interface{})
+
+	url := fmt.Sprintf("%s://%s:%s%s", c.Config.Scheme, c.Config.Host, strconv.Itoa(c.Config.Port), uri)
+
+	if c.Config.UseToken {
+		if uri == "/run" {
+			reqData["token"] = c.Config.Token
+		}
+	} else {
+		reqData["username"] = c.Config.Username
+		reqData["password"] = c.Config.Password
+		reqData["eauth"] = c.Config.Eauth
+	}
+
+	for k, v := range data {
+		reqData[k] = v
+	}
+
+	reqBody, err := convertToJSONString(reqData)
+	if err != nil {
+		return nil, err
+	}
+	var sessionToken string
+	if c.Config.UseToken && uri != "/run" {
+		if sessionToken, err = c.getSessionToken(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err = c.do(ctx, span, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer([]byte(reqBody)))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		if sessionToken != "" {
+			req.Header.Set("X-Auth-Token", sessionToken)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	if resp.StatusCode != 200 {
+		return nil, newAPIError(resp)
+	}
+
+	return resp, nil
+}
+
+// do sends a request, built again for every attempt, and retries it up to MaxRetries times when salt-api
+// can not be reached or answers 502 or 503. The number of retries is recorded on the span.
+func (c *Client) do(ctx context.Context, span trace.Span, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	wait := c.Config.RetryWait
+	for retries := 0; ; retries++ {
+		span.SetAttributes(attribute.Int("salt.retries", retries))
+
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.Client.Do(req)
+		if retries >= c.Config.MaxRetries || !retryable(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// retryable tells whether a request surely did not reach salt-api: the connection to it failed, or the
+// proxy in front of it answered that it is unavailable.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+	return resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable
+}
+
+func convertToJSONString(data map[string]interface{}) (string, error) {
+	ret, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return string(ret), nil
+}
+
+func parseResponseBody(resp *http.Response, extractedData interface{}) error {
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(data, extractedData)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -1,8 +1,16 @@
-package saltstack
+package saltapi
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi/saltapitest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -95,3 +103,50 @@ func TestNotValidClientWithNoTokenProvided(t *testing.T) {
 	_, err := NewClient(config)
 	assert.Error(t, err)
 }
+
+func TestClientRetries(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	var unavailable int
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unavailable > 0 {
+			unavailable--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		server.Server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+	port, _ := strconv.Atoi(strings.TrimPrefix(flaky.URL, "http://127.0.0.1:"))
+	client, err := NewClient(Config{Host: "127.0.0.1", Port: port, Scheme: "http", Username: "username", Password: "password", Eauth: "sharedsecret", MaxRetries: 2, RetryWait: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	unavailable = 2
+	_, err = client.KeyListAll(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, server.CallsTo("wheel", "key.list_all"), 1)
+
+	unavailable = 3
+	_, err = client.KeyListAll(ctx)
+	var apiError *APIError
+	if assert.True(t, errors.As(err, &apiError)) {
+		assert.Equal(t, http.StatusServiceUnavailable, apiError.StatusCode)
+	}
+	assert.Len(t, server.CallsTo("wheel", "key.list_all"), 1)
+
+	// The errors of salt-api are not retried
+	server.Perms = nil
+	_, err = client.KeyListAll(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, 0, unavailable)
+
+	// A salt-api which can not be reached is retried
+	flaky.Close()
+	client.Client.CloseIdleConnections()
+	start := time.Now()
+	_, err = client.KeyListAll(ctx)
+	assert.Error(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 3*time.Millisecond)
+}
@@ -0,0 +1,40 @@
+package saltapi
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// ErrKeyExists is returned when generating the key of a minion which already has an accepted key.
+var ErrKeyExists = errors.New("the minion already has an accepted key")
+
+// APIError is returned when salt-api answers with an HTTP status other than 200,
+// e.g. 401 for eauth or permission failures.
+type APIError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func newAPIError(resp *http.Response) *APIError {
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}
+}
+
+func (e *APIError) Error() string {
+	return e.Status
+}
+
+// FunctionError is returned when a wheel, runner or local function fails on the Salt Master.
+type FunctionError struct {
+	Client  string
+	Fun     string
+	Message string
+}
+
+func (e *FunctionError) Error() string {
+	return fmt.Sprintf("%s function %s failed: %s", e.Client, e.Fun, e.Message)
+}
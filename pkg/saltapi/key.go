@@ -0,0 +1,349 @@
+package saltapi
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Key buckets of the Salt Master PKI, as named by the wheel key functions.
+const (
+	KeyAccepted = "minions"
+	KeyPending  = "minions_pre"
+	KeyRejected = "minions_rejected"
+	KeyDenied   = "minions_denied"
+)
+
+// KeyBuckets lists the key buckets of the Salt Master PKI.
+var KeyBuckets = []string{KeyAccepted, KeyPending, KeyRejected, KeyDenied}
+
+// KeyPair is a minion key pair in PEM format.
+type KeyPair struct {
+	Public  string `json:"pub"`
+	Private string `json:"priv"`
+}
+
+// KeyGenAccept generates a key pair on the Salt Master and accepts its public key.
+// Unless force is set, it returns ErrKeyExists if the minion already has an accepted key.
+func (c *Client) KeyGenAccept(ctx context.Context, minionId string, keySize int, force bool) (KeyPair, error) {
+	kwargs := map[string]interface{}{
+		"id_":     minionId,
+		"keysize": keySize,
+	}
+	if force {
+		kwargs["force"] = true
+	}
+
+	var keyPair KeyPair
+	if err := c.Wheel(ctx, "key.gen_accept", kwargs, &keyPair); err != nil {
+		return KeyPair{}, err
+	}
+
+	if keyPair.Public == "" {
+		return KeyPair{}, ErrKeyExists
+	}
+
+	return keyPair, nil
+}
+
+// KeyPrint returns the public keys of the minions matching a glob, or a comma separated list of globs,
+// by bucket and minion ID.
+func (c *Client) KeyPrint(ctx context.Context, match string) (map[string]map[string]string, error) {
+	keys := map[string]map[string]string{}
+	if err := c.Wheel(ctx, "key.print", map[string]interface{}{"match": match}, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// KeyListAll returns the minion IDs of every bucket.
+func (c *Client) KeyListAll(ctx context.Context) (map[string][]string, error) {
+	keys := map[string][]string{}
+	if err := c.Wheel(ctx, "key.list_all", nil, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// KeyFind returns the bucket holding the key of a minion, using its exact ID.
+// It returns an empty bucket if the minion has no key.
+func (c *Client) KeyFind(ctx context.Context, minionId string) (string, error) {
+	keys, err := c.KeyListAll(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for _, bucket := range KeyBuckets {
+		for _, id := range keys[bucket] {
+			if id == minionId {
+				return bucket, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// KeyFinger returns the fingerprints of the keys of the minions matching a glob, by bucket.
+// An empty hash type uses the hash_type of the Salt Master.
+func (c *Client) KeyFinger(ctx context.Context, match string, hashType string) (map[string]map[string]string, error) {
+	kwargs := map[string]interface{}{"match": match}
+	if hashType != "" {
+		kwargs["hash_type"] = hashType
+	}
+
+	var ret map[string]map[string]string
+	if err := c.Wheel(ctx, "key.finger", kwargs, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// KeyAccept accepts the pending keys of the minions matching a glob, and optionally
+// the rejected and denied ones.
+func (c *Client) KeyAccept(ctx context.Context, match string, includeRejected bool, includeDenied bool) error {
+	kwargs := map[string]interface{}{
+		"match":            match,
+		"include_rejected": includeRejected,
+		"include_denied":   includeDenied,
+	}
+	return c.Wheel(ctx, "key.accept", kwargs, nil)
+}
+
+// KeyReject rejects the pending keys of the minions matching a glob, and optionally
+// the accepted and denied ones.
+func (c *Client) KeyReject(ctx context.Context, match string, includeAccepted bool, includeDenied bool) error {
+	kwargs := map[string]interface{}{
+		"match":            match,
+		"include_accepted": includeAccepted,
+		"include_denied":   includeDenied,
+	}
+	return c.Wheel(ctx, "key.reject", kwargs, nil)
+}
+
+// KeyDelete deletes the keys of the minions matching a glob from every bucket. KeyDeleteMinions
+// deletes the keys of exact minion IDs.
+func (c *Client) KeyDelete(ctx context.Context, match string) error {
+	return c.Wheel(ctx, "key.delete", map[string]interface{}{"match": match}, nil)
+}
+
+// KeyDeleteDict deletes the keys listed by bucket, e.g. {"minions_denied": ["minion-1"]}.
+func (c *Client) KeyDeleteDict(ctx context.Context, match map[string][]string) error {
+	return c.Wheel(ctx, "key.delete_dict", map[string]interface{}{"match": match}, nil)
+}
+
+// KeyCheckMinionCache drops the data the Salt Master caches for the minions which have no accepted
+// key, with the `key.check_minion_cache` wheel function. The data of the preserved minions is kept.
+func (c *Client) KeyCheckMinionCache(ctx context.Context, preserveMinions []string) error {
+	var kwargs map[string]interface{}
+	if len(preserveMinions) > 0 {
+		kwargs = map[string]interface{}{"preserve_minions": preserveMinions}
+	}
+	return c.Wheel(ctx, "key.check_minion_cache", kwargs, nil)
+}
+
+// KeyAcceptDict accepts the keys of the given minion IDs, by bucket, e.g. {"minions_pre": ["minion"]}.
+func (c *Client) KeyAcceptDict(ctx context.Context, match map[string][]string) error {
+	kwargs := map[string]interface{}{
+		"match":            match,
+		"include_rejected": len(match[KeyRejected]) > 0,
+		"include_denied":   len(match[KeyDenied]) > 0,
+	}
+	return c.Wheel(ctx, "key.accept_dict", kwargs, nil)
+}
+
+// KeyRejectDict rejects the keys of the given minion IDs, by bucket, e.g. {"minions": ["minion"]}.
+func (c *Client) KeyRejectDict(ctx context.Context, match map[string][]string) error {
+	kwargs := map[string]interface{}{
+		"match":            match,
+		"include_accepted": len(match[KeyAccepted]) > 0,
+		"include_denied":   len(match[KeyDenied]) > 0,
+	}
+	return c.Wheel(ctx, "key.reject_dict", kwargs, nil)
+}
+
+// KeyPrintMinions returns the public keys of minions by bucket and minion ID, matching their exact IDs.
+// The IDs are escaped into globs which only match themselves, and the keys of other minions are filtered out.
+func (c *Client) KeyPrintMinions(ctx context.Context, minionIds []string) (map[string]map[string]string, error) {
+	match, err := exactMatch(minionIds)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := c.KeyPrint(ctx, match)
+	if err != nil {
+		return nil, err
+	}
+	return filterMinions(keys, minionIds), nil
+}
+
+// KeyFingerMinion returns the fingerprints of the keys of a minion by bucket, matching its exact ID.
+// An empty hash type uses the hash_type of the Salt Master.
+func (c *Client) KeyFingerMinion(ctx context.Context, minionId string, hashType string) (map[string]map[string]string, error) {
+	match, err := exactMatch([]string{minionId})
+	if err != nil {
+		return nil, err
+	}
+
+	fingers, err := c.KeyFinger(ctx, match, hashType)
+	if err != nil {
+		return nil, err
+	}
+	return filterMinions(fingers, []string{minionId}), nil
+}
+
+// KeyAcceptMinions accepts the keys of minions held in one bucket, pending, rejected or denied, matching
+// their exact IDs. Only that bucket is passed to `key.accept_dict`: Salt moves the keys of every bucket it
+// is given in turn, so the key of the last bucket would overwrite the others. It returns the keys it
+// accepted, by the bucket they were in.
+func (c *Client) KeyAcceptMinions(ctx context.Context, bucket string, minionIds []string) (map[string][]string, error) {
+	if bucket != KeyPending && bucket != KeyRejected && bucket != KeyDenied {
+		return nil, fmt.Errorf("the keys of the %s bucket can not be accepted", bucket)
+	}
+	return c.changeMinionKeys(ctx, "accept", minionIds, []string{bucket}, c.KeyAcceptDict)
+}
+
+// KeyRejectMinions rejects the keys of minions held in one bucket, accepted, pending or denied, matching
+// their exact IDs. As with KeyAcceptMinions, only that bucket is passed to `key.reject_dict`. It returns
+// the keys it rejected, by the bucket they were in.
+func (c *Client) KeyRejectMinions(ctx context.Context, bucket string, minionIds []string) (map[string][]string, error) {
+	if bucket != KeyAccepted && bucket != KeyPending && bucket != KeyDenied {
+		return nil, fmt.Errorf("the keys of the %s bucket can not be rejected", bucket)
+	}
+	return c.changeMinionKeys(ctx, "reject", minionIds, []string{bucket}, c.KeyRejectDict)
+}
+
+// KeyDeleteMinions deletes the keys of minions from every bucket, matching their exact IDs. It returns
+// the keys it deleted, by bucket.
+func (c *Client) KeyDeleteMinions(ctx context.Context, minionIds []string) (map[string][]string, error) {
+	return c.changeMinionKeys(ctx, "delete", minionIds, KeyBuckets, c.KeyDeleteDict)
+}
+
+// changeMinionKeys applies a `*_dict` key function to the keys of minions, as the other key functions
+// treat their match as a glob. The keys are listed by `key.list_all` before the call, so only the exact
+// IDs found in the given buckets are passed to it, and after the call, to return the keys it moved or
+// deleted. The keys it left in place are reported as an error.
+func (c *Client) changeMinionKeys(ctx context.Context, action string, minionIds []string, from []string, change func(context.Context, map[string][]string) error) (map[string][]string, error) {
+	before, err := c.KeyListAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	match := findMinions(before, minionIds, from)
+	if len(match) == 0 {
+		return match, nil
+	}
+	if err := change(ctx, match); err != nil {
+		return nil, err
+	}
+
+	after, err := c.KeyListAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := map[string][]string{}
+	left := findMinions(after, flattenMinions(match), from)
+	var failed []string
+	for bucket, ids := range match {
+		for _, id := range ids {
+			if contains(left[bucket], id) {
+				failed = append(failed, fmt.Sprintf("%s (%s)", id, bucket))
+			} else {
+				changed[bucket] = append(changed[bucket], id)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return changed, fmt.Errorf("the Salt Master did not %s the keys of %s", action, strings.Join(failed, ", "))
+	}
+	return changed, nil
+}
+
+// exactMatch escapes minion IDs into a comma separated list of globs which only match them. Salt splits
+// the match on commas before matching the globs, so an ID with a comma can not be matched.
+func exactMatch(minionIds []string) (string, error) {
+	globs := make([]string, 0, len(minionIds))
+	for _, id := range minionIds {
+		if id == "" || strings.Contains(id, ",") {
+			return "", fmt.Errorf("the minion ID %q can not be matched by the key functions of Salt", id)
+		}
+
+		var glob strings.Builder
+		for _, r := range id {
+			switch r {
+			case '*', '?', '[':
+				glob.WriteString("[" + string(r) + "]")
+			default:
+				glob.WriteRune(r)
+			}
+		}
+		globs = append(globs, glob.String())
+	}
+	return strings.Join(globs, ","), nil
+}
+
+// filterMinions keeps the entries of the given minion IDs in a result of the key functions.
+func filterMinions(keys map[string]map[string]string, minionIds []string) map[string]map[string]string {
+	ret := map[string]map[string]string{}
+	for bucket, entries := range keys {
+		for id, value := range entries {
+			if !contains(minionIds, id) {
+				continue
+			}
+			if ret[bucket] == nil {
+				ret[bucket] = map[string]string{}
+			}
+			ret[bucket][id] = value
+		}
+	}
+	return ret
+}
+
+// findMinions returns the given minion IDs listed by `key.list_all` in the given buckets, by bucket.
+func findMinions(keys map[string][]string, minionIds []string, buckets []string) map[string][]string {
+	ret := map[string][]string{}
+	for _, bucket := range buckets {
+		for _, id := range keys[bucket] {
+			if contains(minionIds, id) {
+				ret[bucket] = append(ret[bucket], id)
+			}
+		}
+	}
+	return ret
+}
+
+func flattenMinions(keys map[string][]string) []string {
+	var ids []string
+	for _, bucketIds := range keys {
+		for _, id := range bucketIds {
+			if !contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyWrite places a public key in a bucket of the Salt Master PKI. Salt has no wheel function
+// for it, so the key is written by `file.write` executed on the master by the `salt.cmd` runner.
+func (c *Client) KeyWrite(ctx context.Context, bucket string, minionId string, publicKey string) error {
+	if err := ValidateMinionId(minionId); err != nil {
+		return err
+	}
+
+	keyPath := path.Join(c.Config.PKIDir, bucket, minionId)
+	args := []interface{}{"file.write", keyPath, strings.TrimRight(publicKey, "\n")}
+	return c.Runner(ctx, "salt.cmd", args, nil, nil)
+}
@@ -0,0 +1,105 @@
+package saltapi
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+)
+
+type masterKeyResult struct {
+	Local map[string]string `json:"local"`
+}
+
+// MasterKey returns the public key of the Salt Master, `master.pub`.
+func (c *Client) MasterKey(ctx context.Context) (string, error) {
+	var ret masterKeyResult
+	if err := c.Wheel(ctx, "key.master_key_str", nil, &ret); err != nil {
+		return "", err
+	}
+
+	key, ok := ret.Local["master.pub"]
+	if !ok {
+		return "", &FunctionError{Client: "wheel", Fun: "key.master_key_str", Message: "missing master.pub in the return"}
+	}
+	return key, nil
+}
+
+// MasterFinger returns the fingerprint of the public key of the Salt Master, as minions expect it
+// in their `master_finger` setting. An empty hash type uses the hash_type of the Salt Master.
+func (c *Client) MasterFinger(ctx context.Context, hashType string) (string, error) {
+	kwargs := map[string]interface{}{}
+	if hashType != "" {
+		kwargs["hash_type"] = hashType
+	}
+
+	var ret masterKeyResult
+	if err := c.Wheel(ctx, "key.finger_master", kwargs, &ret); err != nil {
+		return "", err
+	}
+
+	finger, ok := ret.Local["master.pub"]
+	if !ok {
+		return "", &FunctionError{Client: "wheel", Fun: "key.finger_master", Message: "missing master.pub in the return"}
+	}
+	return finger, nil
+}
+
+// MasterSignKey returns the public signing key of the Salt Master, e.g. `master_sign.pub`,
+// or an empty string when `master_sign_pubkey` is not enabled. It uses the `salt.cmd` runner.
+func (c *Client) MasterSignKey(ctx context.Context) (string, error) {
+	var enabled interface{}
+	if err := c.Runner(ctx, "salt.cmd", []interface{}{"config.get", "master_sign_pubkey"}, nil, &enabled); err != nil {
+		return "", err
+	}
+	if enabled != true {
+		return "", nil
+	}
+
+	var name string
+	if err := c.Runner(ctx, "salt.cmd", []interface{}{"config.get", "master_sign_key_name"}, nil, &name); err != nil {
+		return "", err
+	}
+	if name == "" {
+		name = "master_sign"
+	}
+
+	var key string
+	if err := c.Runner(ctx, "salt.cmd", []interface{}{"file.read", path.Join(c.Config.PKIDir, fmt.Sprintf("%s.pub", name))}, nil, &key); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// MasterMinionIds returns the minion IDs the Salt Master itself may hold a key for: its `id`, which the
+// syndic running on it uses, and its `fqdn` and `host` grains, one of which the minion running on it
+// usually uses. It uses the `salt.cmd` runner.
+func (c *Client) MasterMinionIds(ctx context.Context) ([]string, error) {
+	grains := map[string]interface{}{}
+	if err := c.Runner(ctx, "salt.cmd", []interface{}{"grains.item", "id", "fqdn", "host"}, nil, &grains); err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, grain := range grains {
+		id, ok := grain.(string)
+		if ok && id != "" && !contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// MasterHashType returns the `hash_type` of the Salt Master, which it uses for the fingerprints of the keys.
+// It uses the `salt.cmd` runner.
+func (c *Client) MasterHashType(ctx context.Context) (string, error) {
+	var hashType string
+	if err := c.Runner(ctx, "salt.cmd", []interface{}{"config.get", "hash_type"}, nil, &hashType); err != nil {
+		return "", err
+	}
+	if hashType == "" {
+		return "", &FunctionError{Client: "runner", Fun: "salt.cmd", Message: "the hash_type of the Salt Master is not set"}
+	}
+	return hashType, nil
+}
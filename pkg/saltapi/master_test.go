@@ -0,0 +1,76 @@
+package saltapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi/saltapitest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientMasterKey(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	client := testClient(t, server)
+	ctx := context.Background()
+
+	key, err := client.MasterKey(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, server.MasterPublicKey, key)
+
+	finger, err := client.MasterFinger(ctx, "md5")
+	assert.NoError(t, err)
+	expected, _ := saltapitest.Fingerprint(server.MasterPublicKey, "md5")
+	assert.Equal(t, expected, finger)
+}
+
+func TestClientMasterSignKey(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	client := testClient(t, server)
+	ctx := context.Background()
+
+	key, err := client.MasterSignKey(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, key)
+	assert.Len(t, server.CallsTo("runner", "salt.cmd"), 1)
+
+	_, server.MasterSignPublicKey, _ = saltapitest.GenerateKeyPair(2048)
+	server.Config["master_sign_pubkey"] = true
+	server.Config["master_sign_key_name"] = "signing"
+
+	key, err = client.MasterSignKey(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, server.MasterSignPublicKey, key)
+
+	calls := server.CallsTo("runner", "salt.cmd")
+	assert.Equal(t, []interface{}{"file.read", "/etc/salt/pki/master/signing.pub"}, calls[len(calls)-1]["arg"])
+}
+
+func TestClientMasterMinionIds(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	client := testClient(t, server)
+	ctx := context.Background()
+
+	ids, err := client.MasterMinionIds(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"salt", "salt.domain.com", "salt.domain.com_master"}, ids)
+
+	server.Grains = map[string]interface{}{"id": "salt", "fqdn": "salt", "host": ""}
+	ids, err = client.MasterMinionIds(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"salt"}, ids)
+}
+
+func TestClientMasterHashType(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	client := testClient(t, server)
+	ctx := context.Background()
+
+	server.Config["hash_type"] = "sha512"
+	hashType, err := client.MasterHashType(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "sha512", hashType)
+
+	delete(server.Config, "hash_type")
+	_, err = client.MasterHashType(ctx)
+	assert.Error(t, err)
+}
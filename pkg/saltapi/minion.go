@@ -0,0 +1,98 @@
+package saltapi
+
+import (
+	"context"
+	"fmt"
+)
+
+// ActiveJob is a job which runs on minions, as returned by the `jobs.active` runner.
+type ActiveJob struct {
+	Function  string      `json:"Function"`
+	Target    interface{} `json:"Target"`
+	User      string      `json:"User"`
+	StartTime string      `json:"StartTime"`
+	// The minions still running the job, with the ID of the process running it.
+	Running []map[string]interface{} `json:"Running"`
+}
+
+// RunningOn tells whether the job still runs on a minion.
+func (j ActiveJob) RunningOn(minionId string) bool {
+	for _, running := range j.Running {
+		if _, ok := running[minionId]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// JobsActive returns the jobs which run on minions, by job ID, with the `jobs.active` runner.
+func (c *Client) JobsActive(ctx context.Context) (map[string]ActiveJob, error) {
+	jobs := map[string]ActiveJob{}
+	if err := c.Runner(ctx, "jobs.active", nil, nil, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// RevokeAuth makes a minion revoke its authentication with the Salt Master by executing
+// `saltutil.revoke_auth` on it. Unless `allow_minion_key_revoke` is disabled, the Salt Master
+// deletes the key of the minion. It returns false if the minion did not answer.
+func (c *Client) RevokeAuth(ctx context.Context, minionId string) (bool, error) {
+	ret := map[string]interface{}{}
+	if err := c.Local(ctx, minionId, "list", "saltutil.revoke_auth", nil, nil, &ret); err != nil {
+		return false, err
+	}
+
+	revoked, ok := ret[minionId]
+	if !ok {
+		return false, nil
+	}
+	if revoked != true {
+		return true, &FunctionError{Client: "local", Fun: "saltutil.revoke_auth", Message: fmt.Sprint(revoked)}
+	}
+	return true, nil
+}
+
+// CacheClearAll clears the grains, pillar and mine data the Salt Master caches for a minion,
+// with the `cache.clear_all` runner. The minion is targeted by its key, so it must still have one.
+func (c *Client) CacheClearAll(ctx context.Context, minionId string) error {
+	kwargs := map[string]interface{}{
+		"tgt":      minionId,
+		"tgt_type": "list",
+	}
+
+	var cleared interface{}
+	if err := c.Runner(ctx, "cache.clear_all", nil, kwargs, &cleared); err != nil {
+		return err
+	}
+	if cleared != true {
+		return &FunctionError{Client: "runner", Fun: "cache.clear_all", Message: fmt.Sprint(cleared)}
+	}
+	return nil
+}
+
+// TestPing executes `test.ping` on a minion. It returns false if the minion did not answer.
+func (c *Client) TestPing(ctx context.Context, minionId string) (bool, error) {
+	ret := map[string]interface{}{}
+	if err := c.Local(ctx, minionId, "list", "test.ping", nil, nil, &ret); err != nil {
+		return false, err
+	}
+	return ret[minionId] == true, nil
+}
+
+// GrainsItem returns the given grains of a minion with `grains.item`. It returns false if the minion
+// did not answer, which Salt reports either by leaving it out of the returns or by a message.
+func (c *Client) GrainsItem(ctx context.Context, minionId string, grains ...string) (map[string]interface{}, bool, error) {
+	args := make([]interface{}, 0, len(grains))
+	for _, grain := range grains {
+		args = append(args, grain)
+	}
+
+	ret := map[string]interface{}{}
+	if err := c.Local(ctx, minionId, "list", "grains.item", args, nil, &ret); err != nil {
+		return nil, false, err
+	}
+
+	items, ok := ret[minionId].(map[string]interface{})
+	return items, ok, nil
+}
@@ -0,0 +1,9 @@
+package saltapi
+
+import "github.com/imperva/terraform-provider-saltstack/pkg/minionid"
+
+// ValidateMinionId checks a minion ID against the rules of Salt's `valid_id`, and rejects commas, which the
+// key functions of Salt split their match on. See minionid.Validate.
+func ValidateMinionId(minionId string) error {
+	return minionid.Validate(minionId)
+}
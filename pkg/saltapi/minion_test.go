@@ -0,0 +1,128 @@
+package saltapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi/saltapitest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientJobsActive(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	server.Handle("runner", "jobs.active", func(s *saltapitest.Server, low saltapitest.Lowstate) (interface{}, error) {
+		return map[string]interface{}{
+			"20261019135149.686166": map[string]interface{}{
+				"Function":  "state.apply",
+				"Target":    "*",
+				"User":      "root",
+				"StartTime": "2026, Oct 19 13:51:49.686166",
+				"Running":   []map[string]int{{"web-1": 1234}},
+				"Returned":  []string{"web-2"},
+			},
+		}, nil
+	})
+	client := testClient(t, server)
+
+	jobs, err := client.JobsActive(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	job := jobs["20261019135149.686166"]
+	assert.Equal(t, "state.apply", job.Function)
+	assert.True(t, job.RunningOn("web-1"))
+	assert.False(t, job.RunningOn("web-2"))
+}
+
+func TestClientRevokeAuth(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	server.Perms = append(server.Perms, ".*")
+	server.Handle("local", "saltutil.revoke_auth", func(s *saltapitest.Server, low saltapitest.Lowstate) (interface{}, error) {
+		switch low["tgt"] {
+		case "web-1":
+			return map[string]bool{"web-1": true}, nil
+		case "web-2":
+			return map[string]bool{"web-2": false}, nil
+		}
+		return map[string]bool{}, nil
+	})
+	client := testClient(t, server)
+	ctx := context.Background()
+
+	reached, err := client.RevokeAuth(ctx, "web-1")
+	assert.NoError(t, err)
+	assert.True(t, reached)
+	assert.Equal(t, "list", server.CallsTo("local", "saltutil.revoke_auth")[0]["tgt_type"])
+
+	reached, err = client.RevokeAuth(ctx, "web-2")
+	assert.True(t, reached)
+	var functionError *FunctionError
+	assert.True(t, errors.As(err, &functionError))
+
+	reached, err = client.RevokeAuth(ctx, "web-3")
+	assert.NoError(t, err)
+	assert.False(t, reached)
+}
+
+func TestClientCacheClearAll(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	server.Handle("runner", "cache.clear_all", func(s *saltapitest.Server, low saltapitest.Lowstate) (interface{}, error) {
+		return low["tgt"] == "web-1" && low["tgt_type"] == "list", nil
+	})
+	client := testClient(t, server)
+	ctx := context.Background()
+
+	assert.NoError(t, client.CacheClearAll(ctx, "web-1"))
+	var functionError *FunctionError
+	assert.True(t, errors.As(client.CacheClearAll(ctx, "web-2"), &functionError))
+}
+
+func TestClientKeyCheckMinionCache(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	client := testClient(t, server)
+	ctx := context.Background()
+
+	assert.NoError(t, client.KeyCheckMinionCache(ctx, nil))
+	assert.NoError(t, client.KeyCheckMinionCache(ctx, []string{"web-1"}))
+	calls := server.CallsTo("wheel", "key.check_minion_cache")
+	if assert.Len(t, calls, 2) {
+		assert.NotContains(t, calls[0], "preserve_minions")
+		assert.Equal(t, []interface{}{"web-1"}, calls[1]["preserve_minions"])
+	}
+}
+
+func TestClientTestPingGrainsItem(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	server.Perms = append(server.Perms, ".*")
+	server.Handle("local", "test.ping", func(s *saltapitest.Server, low saltapitest.Lowstate) (interface{}, error) {
+		if low["tgt"] == "web-1" {
+			return map[string]bool{"web-1": true}, nil
+		}
+		return map[string]bool{}, nil
+	})
+	server.Handle("local", "grains.item", func(s *saltapitest.Server, low saltapitest.Lowstate) (interface{}, error) {
+		if low["tgt"] == "web-1" {
+			return map[string]interface{}{"web-1": map[string]string{"saltversion": "3004.2", "os": "Ubuntu"}}, nil
+		}
+		return map[string]interface{}{low["tgt"].(string): "Minion did not return. [No response]"}, nil
+	})
+	client := testClient(t, server)
+	ctx := context.Background()
+
+	online, err := client.TestPing(ctx, "web-1")
+	assert.NoError(t, err)
+	assert.True(t, online)
+	online, err = client.TestPing(ctx, "web-2")
+	assert.NoError(t, err)
+	assert.False(t, online)
+
+	grains, ok, err := client.GrainsItem(ctx, "web-1", "saltversion", "os")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"saltversion": "3004.2", "os": "Ubuntu"}, grains)
+	assert.Equal(t, []interface{}{"saltversion", "os"}, server.CallsTo("local", "grains.item")[0]["arg"])
+
+	_, ok, err = client.GrainsItem(ctx, "web-2", "os")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,259 @@
+package saltapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+)
+
+// Environment variables selecting the record/replay mode of the client.
+//
+// With SALTSTACK_RECORDER_MODE=record every salt-api interaction is appended, sanitized, to the
+// SALTSTACK_RECORDER_FIXTURE file. With SALTSTACK_RECORDER_MODE=replay the responses are served
+// from that file and salt-api is never contacted.
+const (
+	RecorderModeEnvVar    = "SALTSTACK_RECORDER_MODE"
+	RecorderFixtureEnvVar = "SALTSTACK_RECORDER_FIXTURE"
+
+	RecorderModeRecord = "record"
+	RecorderModeReplay = "replay"
+)
+
+const redacted = "REDACTED"
+
+// Fields holding credentials or private keys.
+var sensitiveFields = map[string]bool{
+	"password": true,
+	"token":    true,
+	"priv":     true,
+}
+
+var privateKeyRegexp = regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`)
+
+type Fixture struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Body   interface{} `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	Status     string            `json:"status"`
+	StatusCode int               `json:"status_code"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       interface{}       `json:"body,omitempty"`
+}
+
+// Recorder is an http.RoundTripper recording salt-api interactions to a fixture file
+// or replaying them from it.
+type Recorder struct {
+	Mode      string
+	Path      string
+	Transport http.RoundTripper
+
+	mu       sync.Mutex
+	fixture  Fixture
+	replayed map[int]bool
+}
+
+// NewRecorderFromEnv wraps the transport with a Recorder when the record/replay mode is set
+// in the environment, otherwise it returns the transport as is.
+func NewRecorderFromEnv(transport http.RoundTripper) (http.RoundTripper, error) {
+	mode := os.Getenv(RecorderModeEnvVar)
+	if mode == "" {
+		return transport, nil
+	}
+
+	path := os.Getenv(RecorderFixtureEnvVar)
+	if path == "" {
+		return nil, fmt.Errorf("%s must be set when %s is set", RecorderFixtureEnvVar, RecorderModeEnvVar)
+	}
+
+	return NewRecorder(mode, path, transport)
+}
+
+func NewRecorder(mode string, path string, transport http.RoundTripper) (*Recorder, error) {
+	if mode != RecorderModeRecord && mode != RecorderModeReplay {
+		return nil, fmt.Errorf("the recorder mode %s is not supported. The valid modes are: %s, %s", mode, RecorderModeRecord, RecorderModeReplay)
+	}
+
+	r := &Recorder{Mode: mode, Path: path, Transport: transport, replayed: map[int]bool{}}
+
+	// Recordings are appended, as Terraform starts a new provider process for every command
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !(os.IsNotExist(err) && mode == RecorderModeRecord) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &r.fixture); err != nil {
+			return nil, fmt.Errorf("unable to parse the fixture %s: %w", path, err)
+		}
+	}
+
+	return r, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	recorded := RecordedRequest{Method: req.Method, Path: req.URL.Path, Body: sanitizeBody(reqBody)}
+
+	if r.Mode == RecorderModeReplay {
+		return r.replay(req, recorded)
+	}
+	return r.record(req, recorded)
+}
+
+func (r *Recorder) record(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Request: recorded,
+		Response: RecordedResponse{
+			Status:     resp.Status,
+			StatusCode: resp.StatusCode,
+			Headers:    map[string]string{"Content-Type": resp.Header.Get("Content-Type")},
+			Body:       sanitizeBody(respBody),
+		},
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Identical interactions, e.g. the version detection of every provider process, are recorded once
+	key, _ := json.Marshal(interaction)
+	for _, i := range r.fixture.Interactions {
+		if candidate, _ := json.Marshal(i); bytes.Equal(key, candidate) {
+			return resp, nil
+		}
+	}
+	r.fixture.Interactions = append(r.fixture.Interactions, interaction)
+
+	data, err := json.MarshalIndent(r.fixture, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(r.Path, data, 0600); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// replay serves the first recorded response of the request which was not served yet.
+// Once all of them are served, the last one is served again.
+func (r *Recorder) replay(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	key, err := json.Marshal(recorded)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	match := -1
+	for i, interaction := range r.fixture.Interactions {
+		candidate, _ := json.Marshal(interaction.Request)
+		if !bytes.Equal(key, candidate) {
+			continue
+		}
+		match = i
+		if !r.replayed[i] {
+			break
+		}
+	}
+
+	if match < 0 {
+		return nil, fmt.Errorf("no interaction recorded in %s for %s %s %s", r.Path, recorded.Method, recorded.Path, key)
+	}
+	r.replayed[match] = true
+
+	recordedResp := r.fixture.Interactions[match].Response
+	body, err := json.Marshal(recordedResp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &http.Response{
+		Status:        recordedResp.Status,
+		StatusCode:    recordedResp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+	for k, v := range recordedResp.Headers {
+		resp.Header.Set(k, v)
+	}
+
+	return resp, nil
+}
+
+// sanitizeBody parses a JSON body and scrubs credentials and private keys from it.
+// A body which is not JSON is kept as a string.
+func sanitizeBody(body []byte) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return privateKeyRegexp.ReplaceAllString(string(body), redacted)
+	}
+
+	return sanitize(data)
+}
+
+func sanitize(data interface{}) interface{} {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for k, value := range v {
+			if _, ok := value.(string); ok && sensitiveFields[k] {
+				v[k] = redacted
+			} else {
+				v[k] = sanitize(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = sanitize(value)
+		}
+	case string:
+		return privateKeyRegexp.ReplaceAllString(v, redacted)
+	}
+	return data
+}
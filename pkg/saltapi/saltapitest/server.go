@@ -0,0 +1,457 @@
+// Package saltapitest provides an in-memory salt-api emulator for hermetic tests.
+//
+// The emulator implements the rest_cherrypy `/login`, `/token` and `/run` endpoints,
+// the eauth and permission checks of salt-api and the wheel `key.*` functions
+// backed by an in-memory PKI.
+package saltapitest
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imperva/terraform-provider-saltstack/pkg/fnmatch"
+)
+
+// Key buckets of the Salt Master PKI.
+const (
+	Accepted = "minions"
+	Pending  = "minions_pre"
+	Rejected = "minions_rejected"
+	Denied   = "minions_denied"
+)
+
+var buckets = []string{Accepted, Pending, Rejected, Denied}
+
+// Lowstate is a single salt-api command, e.g. {"client": "wheel", "fun": "key.print", "match": "minion"}.
+type Lowstate map[string]interface{}
+
+// HandlerFunc executes a lowstate command and returns its result.
+type HandlerFunc func(s *Server, low Lowstate) (interface{}, error)
+
+type Server struct {
+	*httptest.Server
+
+	Username string
+	Password string
+	Eauth    string
+	// Permissions granted to the user, e.g. "@wheel", "@runner" or ".*" for the local client.
+	Perms []string
+	// Salt version reported by the `test.version` function.
+	Version string
+	// The pki_dir of the master, where `file.write` places keys.
+	PKIDir string
+	// The public key of the master, `master.pub`.
+	MasterPublicKey string
+	// The public signing key of the master, `master_sign.pub`.
+	MasterSignPublicKey string
+	// The master configuration returned by `config.get`.
+	Config map[string]interface{}
+	// The grains of the master returned by `grains.item`.
+	Grains map[string]interface{}
+
+	mu       sync.Mutex
+	keys     map[string]map[string]string
+	tokens   map[string]bool
+	handlers map[string]HandlerFunc
+	calls    []Lowstate
+}
+
+// NewServer starts an emulator which accepts the given credentials with the `sharedsecret` eauth
+// and grants the `@wheel` and `@runner` permissions. It is closed when the test finishes.
+func NewServer(t interface{ Cleanup(func()) }, username string, password string) *Server {
+	s := &Server{
+		Username: username,
+		Password: password,
+		Eauth:    "sharedsecret",
+		Perms:    []string{"@wheel", "@runner"},
+		Version:  "3004.2",
+		PKIDir:   "/etc/salt/pki/master",
+		Config: map[string]interface{}{
+			"hash_type":            "sha256",
+			"master_sign_pubkey":   false,
+			"master_sign_key_name": "master_sign",
+		},
+		Grains: map[string]interface{}{
+			"id":   "salt.domain.com_master",
+			"fqdn": "salt.domain.com",
+			"host": "salt",
+		},
+		keys:     map[string]map[string]string{},
+		tokens:   map[string]bool{},
+		handlers: map[string]HandlerFunc{},
+	}
+	for _, b := range buckets {
+		s.keys[b] = map[string]string{}
+	}
+	_, s.MasterPublicKey, _ = GenerateKeyPair(2048)
+	for fun, h := range wheelKeyHandlers {
+		s.handlers["wheel:"+fun] = h
+	}
+	s.handlers["runner:salt.cmd"] = runnerSaltCmd
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", s.handleLogin)
+	mux.HandleFunc("/token", s.handleToken)
+	mux.HandleFunc("/run", s.handleRun)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Host returns the hostname the emulator listens on.
+func (s *Server) Host() string {
+	u, _ := url.Parse(s.URL)
+	return u.Hostname()
+}
+
+// Port returns the port the emulator listens on.
+func (s *Server) Port() int {
+	u, _ := url.Parse(s.URL)
+	port, _ := strconv.Atoi(u.Port())
+	return port
+}
+
+// Handle registers a handler for a client function, e.g. Handle("wheel", "key.print", h).
+// It replaces the built-in handler of the function if there is one.
+func (s *Server) Handle(client string, fun string, h HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[client+":"+fun] = h
+}
+
+// SetKey stores the public key of a minion in a bucket, removing it from any other bucket.
+func (s *Server) SetKey(bucket string, minionId string, publicKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.moveKey(minionId, bucket, publicKey)
+}
+
+// AddKey stores the public key of a minion in a bucket, keeping the keys of the other buckets,
+// e.g. a denied key next to the accepted one.
+func (s *Server) AddKey(bucket string, minionId string, publicKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[bucket][minionId] = publicKey
+}
+
+// DeleteKey removes the key of a minion from all the buckets.
+func (s *Server) DeleteKey(minionId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.moveKey(minionId, "", "")
+}
+
+// Key returns the bucket and the public key of a minion.
+func (s *Server) Key(minionId string) (string, string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range buckets {
+		if pub, ok := s.keys[b][minionId]; ok {
+			return b, pub, true
+		}
+	}
+	return "", "", false
+}
+
+// KeyIn returns the public key of a minion in a bucket.
+func (s *Server) KeyIn(bucket string, minionId string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pub, ok := s.keys[bucket][minionId]
+	return pub, ok
+}
+
+// Calls returns the lowstate commands received by `/run` so far.
+func (s *Server) Calls() []Lowstate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Lowstate(nil), s.calls...)
+}
+
+// CallsTo returns the received lowstate commands of a client function.
+func (s *Server) CallsTo(client string, fun string) []Lowstate {
+	var ret []Lowstate
+	for _, low := range s.Calls() {
+		if low["client"] == client && low["fun"] == fun {
+			ret = append(ret, low)
+		}
+	}
+	return ret
+}
+
+// moveKey must be called with the lock held.
+func (s *Server) moveKey(minionId string, bucket string, publicKey string) {
+	for _, b := range buckets {
+		delete(s.keys[b], minionId)
+	}
+	if bucket != "" {
+		s.keys[bucket][minionId] = publicKey
+	}
+}
+
+// moveBucket moves the key of a minion from a bucket to another one, as moving the key file does.
+// An empty target bucket deletes the key. It must be called with the lock held.
+func (s *Server) moveBucket(minionId string, from string, to string) {
+	publicKey := s.keys[from][minionId]
+	delete(s.keys[from], minionId)
+	if to != "" {
+		s.keys[to][minionId] = publicKey
+	}
+}
+
+// match returns the minion IDs of a bucket matching a Salt glob, or a comma separated list of globs
+// as Salt's `name_match` does, sorted. It must be called with the lock held.
+func (s *Server) match(bucket string, glob string) []string {
+	ids := []string{}
+	for id := range s.keys[bucket] {
+		for _, g := range strings.Split(glob, ",") {
+			if ok, _ := fnmatch.Match(g, id); ok {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": http.StatusOK, "return": "Please log in"})
+		return
+	}
+
+	creds, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	token := s.newToken()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"return": []interface{}{map[string]interface{}{
+			"token":  token,
+			"start":  float64(time.Now().Unix()),
+			"expire": float64(time.Now().Add(12 * time.Hour).Unix()),
+			"user":   creds["username"],
+			"eauth":  creds["eauth"],
+			"perms":  s.Perms,
+		}},
+	})
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	creds, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, []interface{}{map[string]interface{}{
+		"token":  s.newToken(),
+		"start":  float64(time.Now().Unix()),
+		"expire": float64(time.Now().Add(12 * time.Hour).Unix()),
+		"name":   creds["username"],
+		"eauth":  creds["eauth"],
+	}})
+}
+
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var low Lowstate
+	if err := json.NewDecoder(r.Body).Decode(&low); err != nil {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, low)
+	_, validToken := s.tokens[fmt.Sprint(low["token"])]
+	s.mu.Unlock()
+
+	if !validToken && !s.validCredentials(low) {
+		writeError(w, http.StatusUnauthorized)
+		return
+	}
+
+	client, _ := low["client"].(string)
+	fun, _ := low["fun"].(string)
+	if !s.permitted(client) {
+		writeError(w, http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	h, ok := s.handlers[client+":"+fun]
+	s.mu.Unlock()
+
+	var ret interface{}
+	var err error
+	if ok {
+		ret, err = h(s, low)
+	} else {
+		err = fmt.Errorf("'%s' is not available.", fun)
+	}
+
+	if client == "wheel" {
+		data := map[string]interface{}{
+			"fun":     "wheel." + fun,
+			"jid":     time.Now().Format("20060102150405.000000"),
+			"tag":     "salt/wheel/" + time.Now().Format("20060102150405.000000"),
+			"user":    low["username"],
+			"_stamp":  time.Now().UTC().Format("2006-01-02T15:04:05.000000"),
+			"success": err == nil,
+			"return":  ret,
+		}
+		if err != nil {
+			data["return"] = fmt.Sprintf("Exception occurred in wheel %s: %v", fun, err)
+		}
+		ret = map[string]interface{}{"tag": data["tag"], "data": data}
+	} else if err != nil {
+		ret = fmt.Sprintf("Exception occurred in %s %s: %v", client, fun, err)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"return": []interface{}{ret}})
+}
+
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	var creds map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		writeError(w, http.StatusBadRequest)
+		return nil, false
+	}
+
+	if !s.validCredentials(creds) {
+		writeError(w, http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return creds, true
+}
+
+func (s *Server) validCredentials(creds map[string]interface{}) bool {
+	return creds["username"] == s.Username && creds["password"] == s.Password && creds["eauth"] == s.Eauth
+}
+
+func (s *Server) permitted(client string) bool {
+	for _, p := range s.Perms {
+		if p == "@"+client || (client == "local" && p == ".*") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) newToken() string {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+	token := fmt.Sprintf("%x", b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token] = true
+	return token
+}
+
+// GenerateKeyPair generates an RSA key pair in the PEM formats the Salt Master uses.
+func GenerateKeyPair(bits int) (string, string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return "", "", err
+	}
+
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	priv := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return string(priv), string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})), nil
+}
+
+// The hash types of the hash_type setting of the Salt Master.
+var hashTypes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha224": sha256.New224,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// Fingerprint computes the fingerprint of a PEM key the way Salt's `pem_finger` does: the hash of the
+// non-empty lines between the PEM header and footer, as colon separated hex pairs. It does not share the code of
+// the provider, so that the tests compare both.
+func Fingerprint(key string, hashType string) (string, error) {
+	newHash, ok := hashTypes[hashType]
+	if !ok {
+		return "", fmt.Errorf("unsupported hash type %s", hashType)
+	}
+
+	var lines []string
+	for _, line := range strings.SplitAfter(key, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) < 3 {
+		return "", fmt.Errorf("the key is not in PEM format")
+	}
+	h := newHash()
+	h.Write([]byte(strings.Join(lines[1:len(lines)-1], "")))
+
+	sum := h.Sum(nil)
+	pairs := make([]string, len(sum))
+	for i, b := range sum {
+		pairs[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(pairs, ":"), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeError writes an error the way the rest_cherrypy error page does.
+func writeError(w http.ResponseWriter, status int) {
+	message := map[int]string{
+		http.StatusUnauthorized: "No permission -- see authorization schemes",
+		http.StatusBadRequest:   "Lowstate must be a list or a dictionary",
+	}[status]
+	if message == "" {
+		message = strings.ToLower(http.StatusText(status))
+	}
+
+	writeJSON(w, status, map[string]interface{}{
+		"status":  fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		"return":  message,
+		"message": message,
+	})
+}
@@ -0,0 +1,110 @@
+package saltapitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func post(t *testing.T, s *Server, uri string, body map[string]interface{}) (*http.Response, interface{}) {
+	reqBody, _ := json.Marshal(body)
+	resp, err := http.Post(s.URL+uri, "application/json", bytes.NewBuffer(reqBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var ret interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		t.Fatal(err)
+	}
+	return resp, ret
+}
+
+func TestServerTokenAuthentication(t *testing.T) {
+	s := NewServer(t, "username", "password")
+
+	resp, ret := post(t, s, "/token", map[string]interface{}{"username": "username", "password": "password", "eauth": "sharedsecret"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	token := ret.([]interface{})[0].(map[string]interface{})["token"]
+
+	resp, ret = post(t, s, "/run", map[string]interface{}{"client": "wheel", "fun": "key.list_all", "token": token})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	data := ret.(map[string]interface{})["return"].([]interface{})[0].(map[string]interface{})["data"].(map[string]interface{})
+	assert.Equal(t, true, data["success"])
+
+	resp, _ = post(t, s, "/run", map[string]interface{}{"client": "wheel", "fun": "key.list_all", "token": "wrong"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestServerWheelKeyFunctions(t *testing.T) {
+	s := NewServer(t, "username", "password")
+	creds := map[string]interface{}{"username": "username", "password": "password", "eauth": "sharedsecret", "client": "wheel"}
+	run := func(fun string, kwargs map[string]interface{}) {
+		body := map[string]interface{}{"fun": fun}
+		for k, v := range creds {
+			body[k] = v
+		}
+		for k, v := range kwargs {
+			body[k] = v
+		}
+		resp, _ := post(t, s, "/run", body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	s.SetKey(Pending, "web-1", "pub-1")
+	s.SetKey(Pending, "web-2", "pub-2")
+	s.SetKey(Pending, "db-1", "pub-3")
+
+	run("key.accept", map[string]interface{}{"match": "web-*"})
+	bucket, _, _ := s.Key("web-2")
+	assert.Equal(t, Accepted, bucket)
+	bucket, _, _ = s.Key("db-1")
+	assert.Equal(t, Pending, bucket)
+
+	run("key.reject", map[string]interface{}{"match": "web-1", "include_accepted": true})
+	bucket, _, _ = s.Key("web-1")
+	assert.Equal(t, Rejected, bucket)
+
+	run("key.delete", map[string]interface{}{"match": "*"})
+	_, _, ok := s.Key("db-1")
+	assert.False(t, ok)
+	assert.Len(t, s.CallsTo("wheel", "key.delete"), 1)
+}
+
+func TestServerPermissionFailure(t *testing.T) {
+	s := NewServer(t, "username", "password")
+	s.Perms = []string{"@wheel"}
+
+	resp, ret := post(t, s, "/run", map[string]interface{}{"client": "runner", "fun": "salt.cmd", "arg": []string{"test.version"}, "username": "username", "password": "password", "eauth": "sharedsecret"})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "No permission -- see authorization schemes", ret.(map[string]interface{})["return"])
+}
+
+func TestFingerprint(t *testing.T) {
+	publicKey := `-----BEGIN PUBLIC KEY-----
+MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAuFC6W0sui0zi/NMmvqUf
+YwK9FcHhEOQZ189hAaN8TlcKGYn3o9357kFr5/iyQYMHbgQ/lhRew+gdy64Q85ja
+Wt8jVOAqN4+gs3bpQMrBPtM2e5/zspyuvn05n3gCmZAqwgSM62PjLJxN2eieaIMk
+VyY3GEGWKGPjXU+CUpXgf7+K/hXdJV1BFUFf7vJorfGywXqH9mf4YefiZu/rk47N
+2VO2RdVsqVywc11AbaF//NLi4pnnnzcrXBacvXOt9taUseo3RECCWhigWk/qxNFw
+0CEBsLolSlIv7qlyzf/Q4NVuTnLMRsRCFbxMF6aYCF0smQF0hk0L7R47dS63J7b8
+YQIDAQAB
+-----END PUBLIC KEY-----
+`
+
+	// As reported by `salt-key -f` on the master
+	finger, err := Fingerprint(publicKey, "sha256")
+	assert.NoError(t, err)
+	assert.Equal(t, "fc:33:61:a0:bd:33:cd:6c:69:fd:e5:c5:42:48:e8:f2:d9:68:5e:d0:fb:9c:16:c3:95:71:8d:ef:60:90:b3:ac", finger)
+
+	finger, err = Fingerprint(publicKey, "md5")
+	assert.NoError(t, err)
+	assert.Equal(t, "62:b9:e7:ea:91:a4:dd:ae:03:cf:8c:bd:27:8f:06:fe", finger)
+
+	_, err = Fingerprint(publicKey, "crc32")
+	assert.Error(t, err)
+}
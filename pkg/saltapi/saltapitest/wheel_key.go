@@ -0,0 +1,351 @@
+package saltapitest
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+var wheelKeyHandlers = map[string]HandlerFunc{
+	"key.gen_accept":  wheelKeyGenAccept,
+	"key.print":       wheelKeyPrint,
+	"key.key_str":     wheelKeyPrint,
+	"key.list_all":    wheelKeyListAll,
+	"key.finger":      wheelKeyFinger,
+	"key.accept":      wheelKeyAccept,
+	"key.accept_dict": wheelKeyAcceptDict,
+	"key.reject":      wheelKeyReject,
+	"key.reject_dict": wheelKeyRejectDict,
+	"key.delete":      wheelKeyDelete,
+	"key.delete_dict": wheelKeyDeleteDict,
+
+	"key.check_minion_cache": wheelKeyCheckMinionCache,
+
+	"key.master_key_str": wheelKeyMasterKeyStr,
+	"key.finger_master":  wheelKeyFingerMaster,
+}
+
+func wheelKeyGenAccept(s *Server, low Lowstate) (interface{}, error) {
+	minionId, err := stringArg(low, "id_")
+	if err != nil {
+		return nil, err
+	}
+
+	keySize := intArg(low, "keysize", 2048)
+	if keySize < 2048 {
+		keySize = 2048
+	}
+
+	s.mu.Lock()
+	_, exists := s.keys[Accepted][minionId]
+	s.mu.Unlock()
+	if exists && !boolArg(low, "force") {
+		return map[string]string{}, nil
+	}
+
+	priv, pub, err := GenerateKeyPair(keySize)
+	if err != nil {
+		return nil, err
+	}
+
+	s.SetKey(Accepted, minionId, pub)
+	return map[string]string{"pub": pub, "priv": priv}, nil
+}
+
+func wheelKeyPrint(s *Server, low Lowstate) (interface{}, error) {
+	match, err := stringArg(low, "match")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ret := map[string]map[string]string{}
+	for _, b := range buckets {
+		for _, id := range s.match(b, match) {
+			if ret[b] == nil {
+				ret[b] = map[string]string{}
+			}
+			ret[b][id] = s.keys[b][id]
+		}
+	}
+	return ret, nil
+}
+
+func wheelKeyListAll(s *Server, low Lowstate) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ret := map[string][]string{"local": {"master.pem", "master.pub"}}
+	for _, b := range buckets {
+		ret[b] = s.match(b, "*")
+	}
+	return ret, nil
+}
+
+func wheelKeyFinger(s *Server, low Lowstate) (interface{}, error) {
+	match, err := stringArg(low, "match")
+	if err != nil {
+		return nil, err
+	}
+	hashType, _ := stringArg(low, "hash_type")
+	if hashType == "" {
+		hashType = "sha256"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ret := map[string]map[string]string{}
+	for _, b := range buckets {
+		for _, id := range s.match(b, match) {
+			finger, err := Fingerprint(s.keys[b][id], hashType)
+			if err != nil {
+				return nil, err
+			}
+			if ret[b] == nil {
+				ret[b] = map[string]string{}
+			}
+			ret[b][id] = finger
+		}
+	}
+	return ret, nil
+}
+
+// wheelKeyCheckMinionCache returns nothing, like Salt: the emulator caches no minion data.
+func wheelKeyCheckMinionCache(s *Server, low Lowstate) (interface{}, error) {
+	return nil, nil
+}
+
+func wheelKeyMasterKeyStr(s *Server, low Lowstate) (interface{}, error) {
+	return map[string]map[string]string{"local": {"master.pub": s.MasterPublicKey}}, nil
+}
+
+func wheelKeyFingerMaster(s *Server, low Lowstate) (interface{}, error) {
+	hashType, _ := stringArg(low, "hash_type")
+	if hashType == "" {
+		hashType = fmt.Sprint(s.Config["hash_type"])
+	}
+
+	finger, err := Fingerprint(s.MasterPublicKey, hashType)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]map[string]string{"local": {"master.pub": finger}}, nil
+}
+
+func wheelKeyAccept(s *Server, low Lowstate) (interface{}, error) {
+	from := []string{Pending}
+	if boolArg(low, "include_rejected") {
+		from = append(from, Rejected)
+	}
+	if boolArg(low, "include_denied") {
+		from = append(from, Denied)
+	}
+	return s.moveMatching(low, from, Accepted)
+}
+
+func wheelKeyAcceptDict(s *Server, low Lowstate) (interface{}, error) {
+	from := []string{Pending}
+	if boolArg(low, "include_rejected") {
+		from = append(from, Rejected)
+	}
+	if boolArg(low, "include_denied") {
+		from = append(from, Denied)
+	}
+	return s.moveDict(low, from, Accepted)
+}
+
+func wheelKeyReject(s *Server, low Lowstate) (interface{}, error) {
+	from := []string{Pending}
+	if boolArg(low, "include_accepted") {
+		from = append(from, Accepted)
+	}
+	if boolArg(low, "include_denied") {
+		from = append(from, Denied)
+	}
+	return s.moveMatching(low, from, Rejected)
+}
+
+func wheelKeyRejectDict(s *Server, low Lowstate) (interface{}, error) {
+	from := []string{Pending}
+	if boolArg(low, "include_accepted") {
+		from = append(from, Accepted)
+	}
+	if boolArg(low, "include_denied") {
+		from = append(from, Denied)
+	}
+	return s.moveDict(low, from, Rejected)
+}
+
+func wheelKeyDelete(s *Server, low Lowstate) (interface{}, error) {
+	return s.moveMatching(low, buckets, "")
+}
+
+func wheelKeyDeleteDict(s *Server, low Lowstate) (interface{}, error) {
+	return s.moveDict(low, buckets, "")
+}
+
+// moveMatching moves the keys matching the `match` glob from the given buckets to another one.
+// An empty target bucket deletes the keys.
+func (s *Server) moveMatching(low Lowstate, from []string, to string) (interface{}, error) {
+	match, err := stringArg(low, "match")
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ret := map[string][]string{}
+	for _, b := range from {
+		for _, id := range s.match(b, match) {
+			s.moveBucket(id, b, to)
+			if to == "" {
+				ret[b] = append(ret[b], id)
+			} else {
+				ret[to] = append(ret[to], id)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// moveDict moves the keys listed by bucket in the `match` dict to another bucket, from the given buckets
+// only and in their order, as Salt does: the key of a later bucket overwrites the one moved before it.
+// An empty target bucket deletes the keys.
+func (s *Server) moveDict(low Lowstate, from []string, to string) (interface{}, error) {
+	match, ok := low["match"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("missing required argument: match")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ret := map[string][]string{}
+	for _, b := range from {
+		list, _ := match[b].([]interface{})
+		for _, id := range list {
+			minionId := fmt.Sprint(id)
+			if _, ok := s.keys[b][minionId]; !ok {
+				continue
+			}
+			s.moveBucket(minionId, b, to)
+			if to == "" {
+				ret[b] = append(ret[b], minionId)
+			} else {
+				ret[to] = append(ret[to], minionId)
+			}
+		}
+	}
+	return ret, nil
+}
+
+func runnerSaltCmd(s *Server, low Lowstate) (interface{}, error) {
+	args, _ := low["arg"].([]interface{})
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing the function to execute")
+	}
+
+	switch args[0] {
+	case "test.version":
+		return s.Version, nil
+	case "file.write":
+		return s.writeFile(args[1:])
+	case "file.read":
+		return s.readFile(args[1:])
+	case "config.get":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("missing the key to get")
+		}
+		if v, ok := s.Config[fmt.Sprint(args[1])]; ok {
+			return v, nil
+		}
+		return "", nil
+	case "grains.item":
+		grains := map[string]interface{}{}
+		for _, grain := range args[1:] {
+			if v, ok := s.Grains[fmt.Sprint(grain)]; ok {
+				grains[fmt.Sprint(grain)] = v
+			}
+		}
+		return grains, nil
+	}
+	return nil, fmt.Errorf("'%v' is not available.", args[0])
+}
+
+func stringArg(low Lowstate, name string) (string, error) {
+	v, ok := low[name].(string)
+	if !ok {
+		return "", fmt.Errorf("missing required argument: %s", name)
+	}
+	return v, nil
+}
+
+func intArg(low Lowstate, name string, def int) int {
+	if v, ok := low[name].(float64); ok {
+		return int(v)
+	}
+	return def
+}
+
+func boolArg(low Lowstate, name string) bool {
+	v, _ := low[name].(bool)
+	return v
+}
+
+// writeFile emulates `file.write` of public keys into the PKI directory of the master.
+func (s *Server) writeFile(args []interface{}) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("missing the path to write")
+	}
+
+	filePath := fmt.Sprint(args[0])
+	bucket, minionId := path.Split(strings.TrimPrefix(filePath, s.PKIDir+"/"))
+	bucket = strings.TrimSuffix(bucket, "/")
+	if !strings.HasPrefix(filePath, s.PKIDir+"/") || !isBucket(bucket) {
+		return nil, fmt.Errorf("[Errno 13] Permission denied: '%s'", filePath)
+	}
+
+	var content strings.Builder
+	for _, line := range args[1:] {
+		content.WriteString(fmt.Sprint(line) + "\n")
+	}
+
+	s.AddKey(bucket, minionId, content.String())
+	return fmt.Sprintf("Wrote %d lines to \"%s\"", len(args)-1, filePath), nil
+}
+
+// readFile emulates `file.read` of the keys in the PKI directory of the master.
+func (s *Server) readFile(args []interface{}) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("missing the path to read")
+	}
+
+	filePath := fmt.Sprint(args[0])
+	switch filePath {
+	case s.PKIDir + "/master.pub":
+		return s.MasterPublicKey, nil
+	case s.PKIDir + "/" + fmt.Sprint(s.Config["master_sign_key_name"]) + ".pub":
+		if s.MasterSignPublicKey != "" {
+			return s.MasterSignPublicKey, nil
+		}
+	default:
+		bucket, minionId := path.Split(strings.TrimPrefix(filePath, s.PKIDir+"/"))
+		if b, pub, ok := s.Key(minionId); ok && b == strings.TrimSuffix(bucket, "/") {
+			return pub, nil
+		}
+	}
+	return nil, fmt.Errorf("[Errno 2] No such file or directory: '%s'", filePath)
+}
+
+func isBucket(name string) bool {
+	for _, b := range buckets {
+		if b == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package saltapi
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/imperva/terraform-provider-saltstack/pkg/saltapi"
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// lowstateAttributes returns the span attributes describing a salt-api command.
+func lowstateAttributes(data map[string]interface{}) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	for k, name := range map[string]string{"client": "salt.client", "fun": "salt.fun", "id_": "salt.minion_id", "match": "salt.match", "tgt": "salt.tgt"} {
+		if v, ok := data[k].(string); ok {
+			attrs = append(attrs, attribute.String(name, v))
+		}
+	}
+	return attrs
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
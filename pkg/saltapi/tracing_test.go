@@ -0,0 +1,50 @@
+package saltapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi/saltapitest"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestTracingClientPost(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(previous)
+	server := saltapitest.NewServer(t, "username", "password")
+	client, _ := NewClient(Config{Host: server.Host(), Port: server.Port(), Scheme: "http", Username: "username", Password: "password", Eauth: "sharedsecret"})
+
+	_, err := client.PostWithContext(context.Background(), "/run", map[string]interface{}{"client": "wheel", "fun": "key.print", "match": "minion"})
+	assert.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "salt-api /run", spans[0].Name)
+	attrs := spanAttributes(spans[0])
+	assert.Equal(t, "wheel", attrs["salt.client"].AsString())
+	assert.Equal(t, "key.print", attrs["salt.fun"].AsString())
+	assert.Equal(t, int64(200), attrs["http.status_code"].AsInt64())
+	assert.Equal(t, int64(0), attrs["salt.retries"].AsInt64())
+
+	server.Perms = nil
+	_, err = client.PostWithContext(context.Background(), "/run", map[string]interface{}{"client": "wheel", "fun": "key.print", "match": "minion"})
+	assert.Error(t, err)
+	spans = exporter.GetSpans()
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+	assert.Equal(t, int64(401), spanAttributes(spans[1])["http.status_code"].AsInt64())
+}
@@ -0,0 +1,128 @@
+package saltapi
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// SaltVersion is a Salt release number, e.g. 3004.2 or 3006.0rc1.
+// Releases since Neon use the Major.Minor scheme, older ones Year.Month.Patch.
+type SaltVersion struct {
+	Major int
+	Minor int
+	Patch int
+	Raw   string
+}
+
+// MinimumSaltVersion is the oldest Salt Master release whose return shapes the client is tested against.
+var MinimumSaltVersion = SaltVersion{Major: 3002, Raw: "3002"}
+
+// Features whose availability or wire format depends on the Salt Master release.
+// The value is the first release that supports the feature. The wheel functions which change keys are
+// gated on MinimumSaltVersion, as their return shapes are not checked on older releases. A later release
+// which changes one of them moves its entry.
+var Features = map[string]SaltVersion{
+	// The wheel functions which change the keys of the exact minion IDs of a dict of buckets
+	"key.accept_dict": MinimumSaltVersion,
+	"key.reject_dict": MinimumSaltVersion,
+	"key.delete_dict": MinimumSaltVersion,
+	// gen_accept with its `force` argument, which overwrites the accepted key of the minion
+	"key.gen_accept": MinimumSaltVersion,
+}
+
+var saltVersionRegexp = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?`)
+
+func ParseSaltVersion(version string) (SaltVersion, error) {
+	m := saltVersionRegexp.FindStringSubmatch(version)
+	if m == nil {
+		return SaltVersion{}, fmt.Errorf("unable to parse Salt version %q", version)
+	}
+
+	v := SaltVersion{Raw: version}
+	v.Major, _ = strconv.Atoi(m[1])
+	if m[2] != "" {
+		v.Minor, _ = strconv.Atoi(m[2])
+	}
+	if m[3] != "" {
+		v.Patch, _ = strconv.Atoi(m[3])
+	}
+
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 if v is older than, equal to or newer than o.
+func (v SaltVersion) Compare(o SaltVersion) int {
+	for _, p := range [][2]int{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if p[0] < p[1] {
+			return -1
+		}
+		if p[0] > p[1] {
+			return 1
+		}
+	}
+	return 0
+}
+
+func (v SaltVersion) AtLeast(o SaltVersion) bool {
+	return v.Compare(o) >= 0
+}
+
+func (v SaltVersion) String() string {
+	if v.Raw != "" {
+		return v.Raw
+	}
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// SaltVersion returns the Salt Master version. Unless it is pinned in the config, it is
+// detected the first time it is needed, with `test.version` executed on the master by the
+// `salt.cmd` runner. A failed detection is not cached, so that the next call tries again.
+func (c *Client) SaltVersion(ctx context.Context) (SaltVersion, error) {
+	c.versionMu.Lock()
+	defer c.versionMu.Unlock()
+
+	if c.version == nil {
+		version, err := c.detectSaltVersion(ctx)
+		if err != nil {
+			return SaltVersion{}, err
+		}
+		c.version = &version
+	}
+	return *c.version, nil
+}
+
+func (c *Client) detectSaltVersion(ctx context.Context) (SaltVersion, error) {
+	if c.Config.SaltVersion != "" {
+		return ParseSaltVersion(c.Config.SaltVersion)
+	}
+
+	var version string
+	if err := c.Runner(ctx, "salt.cmd", []interface{}{"test.version"}, nil, &version); err != nil {
+		return SaltVersion{}, fmt.Errorf("unable to detect the Salt Master version: %w", err)
+	}
+
+	return ParseSaltVersion(version)
+}
+
+// CheckFeature returns an error if the Salt Master is too old for the given feature.
+// When the version cannot be detected the feature is assumed to be supported
+// and salt-api has the final word. SaltVersion tells the caller about it.
+func (c *Client) CheckFeature(ctx context.Context, feature string) error {
+	since, ok := Features[feature]
+	if !ok {
+		return nil
+	}
+
+	version, err := c.SaltVersion(ctx)
+	if err != nil {
+		return nil
+	}
+
+	if !version.AtLeast(since) {
+		return fmt.Errorf("%s requires Salt Master %s or newer, the Salt Master runs %s", feature, since, version)
+	}
+
+	return nil
+}
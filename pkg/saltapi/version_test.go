@@ -0,0 +1,97 @@
+package saltapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi/saltapitest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSaltVersion(t *testing.T) {
+	cases := map[string]SaltVersion{
+		"3004.2":     {Major: 3004, Minor: 2, Raw: "3004.2"},
+		"3006.0rc1":  {Major: 3006, Minor: 0, Raw: "3006.0rc1"},
+		"3007":       {Major: 3007, Raw: "3007"},
+		"2019.2.8":   {Major: 2019, Minor: 2, Patch: 8, Raw: "2019.2.8"},
+		"v3005.1+12": {Major: 3005, Minor: 1, Raw: "v3005.1+12"},
+	}
+
+	for raw, expected := range cases {
+		version, err := ParseSaltVersion(raw)
+		assert.NoError(t, err, raw)
+		assert.Equal(t, expected, version, raw)
+	}
+}
+
+func TestParseSaltVersionFailed(t *testing.T) {
+	_, err := ParseSaltVersion("unknown")
+	assert.Error(t, err)
+}
+
+func TestSaltVersionCompare(t *testing.T) {
+	v3004, _ := ParseSaltVersion("3004.2")
+	v3006, _ := ParseSaltVersion("3006.1")
+	v2019, _ := ParseSaltVersion("2019.2.8")
+
+	assert.True(t, v3006.AtLeast(v3004))
+	assert.False(t, v3004.AtLeast(v3006))
+	assert.True(t, v3004.AtLeast(v3004))
+	assert.False(t, v2019.AtLeast(SaltVersion{Major: 3002}))
+	assert.Equal(t, 0, v3004.Compare(SaltVersion{Major: 3004, Minor: 2}))
+}
+
+func TestClientSaltVersionFromConfig(t *testing.T) {
+	client, err := NewClient(Config{
+		Host:        "localhost",
+		Username:    "username",
+		Password:    "password",
+		Eauth:       "pam",
+		SaltVersion: "3005.1",
+	})
+	assert.NoError(t, err)
+
+	version, err := client.SaltVersion(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3005, version.Major)
+	assert.Equal(t, 1, version.Minor)
+}
+
+func TestClientSaltVersionDetected(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	server.Version = "3006.1"
+	client := testClient(t, server)
+	ctx := context.Background()
+
+	// A failed detection is not cached
+	server.Perms = []string{"@wheel"}
+	_, err := client.SaltVersion(ctx)
+	assert.Error(t, err)
+
+	server.Perms = []string{"@wheel", "@runner"}
+	version, err := client.SaltVersion(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3006, version.Major)
+
+	// A detected version is
+	server.Version = "3007.0"
+	version, err = client.SaltVersion(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3006, version.Major)
+}
+
+func TestClientCheckFeature(t *testing.T) {
+	Features["test.feature"] = SaltVersion{Major: 3006, Raw: "3006"}
+	defer delete(Features, "test.feature")
+
+	client, _ := NewClient(Config{
+		Host:        "localhost",
+		Username:    "username",
+		Password:    "password",
+		Eauth:       "pam",
+		SaltVersion: "3004.2",
+	})
+
+	assert.Error(t, client.CheckFeature(context.Background(), "test.feature"))
+	assert.NoError(t, client.CheckFeature(context.Background(), "unknown.feature"))
+}
@@ -0,0 +1,79 @@
+package saltstack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/imperva/terraform-provider-saltstack/helper"
+)
+
+func dataSourceMasterKey() *schema.Resource {
+	return &schema.Resource{
+		Description: "Reads the public key of the Salt Master and its fingerprint, e.g. for the `master_finger` setting of minions. Reading the signing key uses the `salt.cmd` runner, which requires the API user to have `@runner` permissions, and is reported by a warning without them.",
+		ReadContext: traceResourceFunc("data.saltstack_master_key.Read", dataSourceMasterKeyRead),
+		Schema: map[string]*schema.Schema{
+			"public_key": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The public key of the Salt Master, `master.pub`.",
+			},
+			"fingerprint": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The fingerprint of the public key of the Salt Master as `key.finger_master` reports it, using the `hash_type` of the provider, or the one of the Salt Master when it is not set. This is the value of the `master_finger` setting of minions.",
+			},
+			"fingerprint_sha256": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The SHA256 fingerprint of the DER encoding of the public key of the Salt Master.",
+			},
+			"sign_public_key": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The public signing key of the Salt Master, e.g. `master_sign.pub`, when `master_sign_pubkey` is enabled. Empty otherwise, or when it can not be read.",
+			},
+		},
+	}
+}
+
+func dataSourceMasterKeyRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	meta := m.(*providerMeta)
+	api := meta.api
+
+	publicKey, err := api.MasterKey(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	fingerprint, err := api.MasterFinger(ctx, meta.hashType)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	fingerprintSha256, err := helper.Sha256Fingerprint(publicKey)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// The signing key is only read through the runner client, whose permission the other attributes do not need
+	signPublicKey, err := api.MasterSignKey(ctx)
+	if err != nil {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "Unable to read the signing key of the Salt Master",
+			Detail:   fmt.Sprintf("%v. sign_public_key is left empty, reading it requires the API user to have `@runner` permissions.", err),
+		})
+	}
+
+	d.Set("public_key", publicKey)
+	d.Set("fingerprint", fingerprint)
+	d.Set("fingerprint_sha256", fingerprintSha256)
+	d.Set("sign_public_key", signPublicKey)
+	d.SetId(fingerprintSha256)
+
+	return diags
+}
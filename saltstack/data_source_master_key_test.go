@@ -0,0 +1,71 @@
+package saltstack
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/imperva/terraform-provider-saltstack/helper"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi/saltapitest"
+)
+
+func TestSaltstackMasterKey_basic(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	dataSourceName := "data.saltstack_master_key.test"
+	fingerprint, _ := saltapitest.Fingerprint(server.MasterPublicKey, "sha256")
+	fingerprintSha256, _ := helper.Sha256Fingerprint(server.MasterPublicKey)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMasterKeyConfig(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(dataSourceName, "public_key", server.MasterPublicKey),
+					resource.TestCheckResourceAttr(dataSourceName, "fingerprint", fingerprint),
+					resource.TestCheckResourceAttr(dataSourceName, "fingerprint_sha256", fingerprintSha256),
+					resource.TestCheckResourceAttr(dataSourceName, "sign_public_key", ""),
+				),
+			},
+		},
+	})
+}
+
+func TestSaltstackMasterKey_signing(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	_, server.MasterSignPublicKey, _ = saltapitest.GenerateKeyPair(2048)
+	server.Config["master_sign_pubkey"] = true
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMasterKeyConfig(),
+				Check:  resource.TestCheckResourceAttr("data.saltstack_master_key.test", "sign_public_key", server.MasterSignPublicKey),
+			},
+		},
+	})
+}
+
+func TestSaltstackMasterKey_withoutRunner(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	server.Perms = []string{"@wheel"}
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMasterKeyConfig(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.saltstack_master_key.test", "public_key", server.MasterPublicKey),
+					resource.TestCheckResourceAttr("data.saltstack_master_key.test", "sign_public_key", ""),
+				),
+			},
+		},
+	})
+}
+
+func testCheckSaltstackMasterKeyConfig() string {
+	return `
+	data saltstack_master_key test {}
+	`
+}
@@ -0,0 +1,147 @@
+package saltstack
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/imperva/terraform-provider-saltstack/helper"
+)
+
+func dataSourceMinionConfig() *schema.Resource {
+	return &schema.Resource{
+		Description: "Renders the configuration of a SaltStack minion from the outputs of a key resource, and a cloud-init document which bootstraps the minion with it, e.g. for the user data of its machine. Nothing is read from the Salt Master.",
+		ReadContext: traceResourceFunc("data.saltstack_minion_config.Read", dataSourceMinionConfigRead),
+		Schema: map[string]*schema.Schema{
+			"minion_id": {
+				Type:             schema.TypeString,
+				Required:         true,
+				Description:      "The ID of SaltStack minion.",
+				ValidateDiagFunc: validateMinionId,
+			},
+			"master": {
+				Type:        schema.TypeList,
+				Required:    true,
+				MinItems:    1,
+				Description: "The addresses of the Salt Masters the minion connects to. More than one address makes a multi-master minion.",
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"master_port": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Description:  "The port of the Salt Master the minion connects to. The minion uses its default `4506` if not set.",
+				ValidateFunc: validation.IsPortNumber,
+			},
+			"master_finger": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Description:      "The fingerprint of the public key of the Salt Master the minion verifies, e.g. the `fingerprint` of the `saltstack_master_key` data source.",
+				ValidateDiagFunc: validateFingerprint,
+			},
+			"private_key": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Description:      "The private key of the minion, e.g. the `private_key` of a `saltstack_minion_key_pair`. When not set with `public_key`, the minion generates its own key pair.",
+				Sensitive:        true,
+				RequiredWith:     []string{"public_key"},
+				ValidateDiagFunc: validateRsaPrivateKey,
+			},
+			"public_key": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Description:      "The public key of the minion, e.g. the `public_key` of a `saltstack_minion_key_pair`.",
+				RequiredWith:     []string{"private_key"},
+				ValidateDiagFunc: validateRsaPublicKey,
+			},
+			"options": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Description: "Other settings of the minion, e.g. `log_level`. The values `true` and `false` are rendered as booleans and decimal integers such as `30` as integers, and any other value as a string, quoted when YAML would read it as another type, e.g. `0644`, `yes` or `null`. `id`, `master`, `master_port` and `master_finger` are set by their own arguments.",
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"platform": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          "linux",
+				Description:      "The platform of the minion: `linux`, which is the default, or `windows`, for which the cloud-init document is meant for cloudbase-init.",
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice([]string{"linux", "windows"}, false)),
+			},
+			"config_dir": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The directory of the configuration of the minion. Defaults to `/etc/salt` on Linux and `C:\\ProgramData\\Salt Project\\Salt\\conf` on Windows.",
+			},
+			"minion_config": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The configuration of the minion in YAML, to place in its `minion.d` directory.",
+			},
+			"cloud_init": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "A cloud-config document which writes `minion_id`, the key pair in `pki/minion` and the configuration of the minion in `minion.d/terraform.conf`, then restarts the minion. On Linux, the private key is only readable by root. It holds the private key, so it is sensitive.",
+				Sensitive:   true,
+			},
+		},
+	}
+}
+
+func dataSourceMinionConfigRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	meta := m.(*providerMeta)
+
+	minionId := normalizeMinionId(meta, d.Get("minion_id").(string))
+	if err := checkMinionId(meta, minionId); err != nil {
+		return diag.FromErr(err)
+	}
+
+	config := helper.MinionConfig{
+		MinionId:     minionId,
+		MasterPort:   d.Get("master_port").(int),
+		MasterFinger: d.Get("master_finger").(string),
+		PrivateKey:   d.Get("private_key").(string),
+		PublicKey:    d.Get("public_key").(string),
+		Options:      map[string]any{},
+		Platform:     d.Get("platform").(string),
+		ConfigDir:    d.Get("config_dir").(string),
+	}
+	for _, master := range d.Get("master").([]interface{}) {
+		config.Masters = append(config.Masters, master.(string))
+	}
+	for name, value := range d.Get("options").(map[string]interface{}) {
+		config.Options[name] = optionValue(value.(string))
+	}
+	if err := config.Validate(); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.Set("minion_id", minionId)
+	d.Set("minion_config", config.Render())
+	d.Set("cloud_init", config.RenderCloudInit())
+	d.SetId(minionId)
+
+	return diags
+}
+
+// optionValue converts the value of an option, which Terraform passes as a string, to a boolean or an
+// integer when it is written as one. Only `true`, `false` and decimal integers without leading zeros are
+// converted, so that e.g. `yes` and `0644` stay strings.
+func optionValue(value string) any {
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if i, err := strconv.Atoi(value); err == nil && strconv.Itoa(i) == value {
+		return i
+	}
+	return value
+}
@@ -0,0 +1,146 @@
+package saltstack
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi/saltapitest"
+)
+
+func TestSaltstackMinionConfig_keyPair(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	dataSourceName := "data.saltstack_minion_config.test"
+	fingerprint, _ := saltapitest.Fingerprint(server.MasterPublicKey, "sha256")
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, KeySize: 2048, KeyGeneration: "local"}.render() + testCheckSaltstackMinionConfigKeyPair(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(dataSourceName, "id", minionId),
+					resource.TestCheckResourceAttr(dataSourceName, "minion_config", fmt.Sprintf("# Managed by Terraform\nid: %q\nmaster: \"salt.domain.com\"\nmaster_finger: %q\nlog_level: info\n", minionId, fingerprint)),
+					testCheckSaltstackMinionConfigCloudInit(dataSourceName, "saltstack_minion_key_pair.test"),
+				),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionConfig_golden(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	dataSourceName := "data.saltstack_minion_config.test"
+	minionConfig, _ := os.ReadFile("../helper/testdata/minion_config/linux_without_key.minion.yaml")
+	cloudInit, _ := os.ReadFile("../helper/testdata/minion_config/linux_without_key.cloud-init.yaml")
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMinionConfig("web-2.domain.com", `"10.20.30.40", "10.20.30.41"`, `master_port = 4606`),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(dataSourceName, "minion_config", string(minionConfig)),
+					resource.TestCheckResourceAttr(dataSourceName, "cloud_init", string(cloudInit)),
+				),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionConfig_invalid(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      testUnitProviderConfig(server) + testCheckSaltstackMinionConfig("web-1.domain.com", `"salt.domain.com"`, `options = { master = "salt-2.domain.com" }`),
+				ExpectError: regexp.MustCompile("the option master can not be set"),
+			},
+			{
+				Config:      testUnitProviderConfig(server) + testCheckSaltstackMinionConfig("web-1.domain.com", `"salt.domain.com"`, `platform = "darwin"`),
+				ExpectError: regexp.MustCompile("expected platform to be one of"),
+			},
+		},
+	})
+}
+
+func testCheckSaltstackMinionConfig(minionId string, masters string, extra string) string {
+	return fmt.Sprintf(`
+	data saltstack_minion_config test {
+		minion_id = "%s"
+		master = [%s]
+		%s
+	}
+	`, minionId, masters, extra)
+}
+
+func testCheckSaltstackMinionConfigKeyPair() string {
+	return `
+	data saltstack_master_key master {}
+
+	data saltstack_minion_config test {
+		minion_id = saltstack_minion_key_pair.test.minion_id
+		master = ["salt.domain.com"]
+		master_finger = data.saltstack_master_key.master.fingerprint
+		private_key = saltstack_minion_key_pair.test.private_key
+		public_key = saltstack_minion_key_pair.test.public_key
+		options = {
+			log_level = "info"
+		}
+	}
+	`
+}
+
+// testCheckSaltstackMinionConfigCloudInit checks that the cloud-init document writes the key pair of
+// a key resource, the private key being only readable by root.
+func testCheckSaltstackMinionConfigCloudInit(dataSourceName string, keyPairName string) resource.TestCheckFunc {
+	indent := func(pem string) string {
+		return "      " + strings.ReplaceAll(strings.TrimSuffix(pem, "\n"), "\n", "\n      ")
+	}
+
+	return func(s *terraform.State) error {
+		cloudInit := s.RootModule().Resources[dataSourceName].Primary.Attributes["cloud_init"]
+		keyPair := s.RootModule().Resources[keyPairName].Primary.Attributes
+
+		expected := []string{
+			"#cloud-config\n",
+			"  - path: \"/etc/salt/pki/minion/minion.pem\"\n    content: |\n" + indent(keyPair["private_key"]) + "\n    owner: root:root\n    permissions: \"0400\"\n",
+			"  - path: \"/etc/salt/pki/minion/minion.pub\"\n    content: |\n" + indent(keyPair["public_key"]) + "\n",
+			"  - [systemctl, restart, salt-minion]\n",
+		}
+		for _, part := range expected {
+			if !strings.Contains(cloudInit, part) {
+				return fmt.Errorf("The cloud-init document does not contain:\n%s\nin:\n%s", part, cloudInit)
+			}
+		}
+		return nil
+	}
+}
+
+func TestOptionValue(t *testing.T) {
+	cases := map[string]any{
+		"true":  true,
+		"false": false,
+		"30":    30,
+		"-1":    -1,
+		"0644":  "0644",
+		"+30":   "+30",
+		"yes":   "yes",
+		"True":  "True",
+		"1e3":   "1e3",
+		"info":  "info",
+	}
+
+	for value, expected := range cases {
+		if actual := optionValue(value); actual != expected {
+			t.Errorf("The option %q is converted to %#v instead of %#v", value, actual, expected)
+		}
+	}
+}
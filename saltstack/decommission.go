@@ -0,0 +1,186 @@
+package saltstack
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi"
+)
+
+func decommissionSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Optional:    true,
+		MaxItems:    1,
+		Description: "Steps run on the Salt Master before the minion's key is destroyed, so that the minion leaves nothing behind. They run in order: `wait_for_jobs`, `clear_cache`, `revoke_auth`, then `check_minion_cache`, and are skipped when `on_destroy` is `abandon`. Each step is reported by its own warning with its result, whether it succeeded, failed or was skipped.",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"wait_for_jobs": {
+					Type:        schema.TypeBool,
+					Optional:    true,
+					Default:     true,
+					Description: "Wait for the jobs running on the minion, as listed by the `jobs.active` runner, to finish.",
+				},
+				"jobs_timeout": {
+					Type:             schema.TypeString,
+					Optional:         true,
+					Default:          "5m",
+					Description:      "How long to wait for the jobs running on the minion, e.g. `30s` or `10m`. Defaults to `5m`.",
+					ValidateDiagFunc: validateDuration,
+				},
+				"clear_cache": {
+					Type:        schema.TypeBool,
+					Optional:    true,
+					Default:     true,
+					Description: "Clear the grains, pillar and mine data the Salt Master caches for the minion with the `cache.clear_all` runner. The data the minion sends afterwards is dropped by `check_minion_cache`.",
+				},
+				"revoke_auth": {
+					Type:        schema.TypeBool,
+					Optional:    true,
+					Default:     true,
+					Description: "Make the minion revoke its authentication with `saltutil.revoke_auth`, if it answers, so that it stops using its key. It needs the permission to run `saltutil.revoke_auth` on the minion. It is skipped when `on_destroy` is `reject`, as the Salt Master deletes the key of a minion which revokes it.",
+				},
+				"check_minion_cache": {
+					Type:        schema.TypeBool,
+					Optional:    true,
+					Default:     true,
+					Description: "Drop the data the Salt Master still caches for the minions which have no accepted key with the `key.check_minion_cache` wheel function, once the minion revoked its authentication. The data of a minion which keeps its key, e.g. because it did not answer `revoke_auth`, is dropped when its key is destroyed.",
+				},
+				"fail_on_error": {
+					Type:        schema.TypeBool,
+					Optional:    true,
+					Default:     false,
+					Description: "Whether a step which fails stops the destroy and leaves the key on the Salt Master, instead of being reported as a warning.",
+				},
+			},
+		},
+	}
+}
+
+// decommissionMinion runs the decommission steps of a key resource before its key is destroyed. The
+// cache is cleared before the authentication is revoked, as `cache.clear_all` targets the minion by its
+// key, which the Salt Master deletes when the minion revokes its authentication. The diagnostics report
+// the result of each step as a warning. A step which fails is reported as an error if fail_on_error is
+// set, in which case the remaining steps are not run.
+func decommissionMinion(ctx context.Context, api *saltapi.Client, d *schema.ResourceData, minionId string) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	steps, ok := d.Get("decommission").([]interface{})
+	if !ok || len(steps) == 0 || d.Get("on_destroy").(string) == "abandon" {
+		return diags
+	}
+	config, _ := steps[0].(map[string]interface{})
+	if config == nil {
+		// An empty block runs all the steps
+		config = map[string]interface{}{"wait_for_jobs": true, "jobs_timeout": "5m", "clear_cache": true, "revoke_auth": true, "check_minion_cache": true, "fail_on_error": false}
+	}
+
+	severity := diag.Warning
+	if config["fail_on_error"].(bool) {
+		severity = diag.Error
+	}
+	report := func(step string, summary string, err error) {
+		diags = append(diags, diag.Diagnostic{
+			Severity: severity,
+			Summary:  fmt.Sprintf("Decommission step %s: %s", step, summary),
+			Detail:   fmt.Sprintf("%v", err),
+		})
+	}
+	done := func(step string, detail string) {
+		tflog.Info(ctx, detail, nil)
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("Decommission step %s: done for minion %s", step, minionId),
+			Detail:   detail,
+		})
+	}
+
+	if config["wait_for_jobs"].(bool) {
+		timeout, _ := time.ParseDuration(config["jobs_timeout"].(string))
+		if err := waitForJobs(ctx, api, minionId, timeout); err != nil {
+			report("wait_for_jobs", fmt.Sprintf("the jobs of minion %s did not finish", minionId), err)
+			if diags.HasError() {
+				return diags
+			}
+		} else {
+			done("wait_for_jobs", fmt.Sprintf("No job runs on minion %s.", minionId))
+		}
+	}
+
+	if config["clear_cache"].(bool) {
+		if err := api.CacheClearAll(ctx, minionId); err != nil {
+			report("clear_cache", fmt.Sprintf("the cache of minion %s was not cleared", minionId), err)
+			if diags.HasError() {
+				return diags
+			}
+		} else {
+			done("clear_cache", fmt.Sprintf("Cleared the grains, pillar and mine data cached for minion %s.", minionId))
+		}
+	}
+
+	if config["revoke_auth"].(bool) {
+		if d.Get("on_destroy").(string) == "reject" {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  fmt.Sprintf("Decommission step revoke_auth: skipped for minion %s", minionId),
+				Detail:   "The Salt Master deletes the key of a minion which revokes its authentication, so revoke_auth is skipped when on_destroy is reject.",
+			})
+		} else if reached, err := api.RevokeAuth(ctx, minionId); err != nil {
+			report("revoke_auth", fmt.Sprintf("minion %s did not revoke its authentication", minionId), err)
+			if diags.HasError() {
+				return diags
+			}
+		} else if !reached {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  fmt.Sprintf("Decommission step revoke_auth: skipped for minion %s", minionId),
+				Detail:   "The minion did not answer, so it keeps its authentication until its key is destroyed.",
+			})
+		} else {
+			done("revoke_auth", fmt.Sprintf("Minion %s revoked its authentication.", minionId))
+		}
+	}
+
+	if config["check_minion_cache"].(bool) {
+		if err := api.KeyCheckMinionCache(ctx, nil); err != nil {
+			report("check_minion_cache", "the cache of the minions without keys was not checked", err)
+			if diags.HasError() {
+				return diags
+			}
+		} else {
+			done("check_minion_cache", "Dropped the data cached for the minions which have no accepted key.")
+		}
+	}
+
+	return diags
+}
+
+// waitForJobs polls the `jobs.active` runner until no job runs on the minion.
+func waitForJobs(ctx context.Context, api *saltapi.Client, minionId string, timeout time.Duration) error {
+	tflog.Debug(ctx, fmt.Sprintf("Waiting for the jobs running on minion %s", minionId), nil)
+	return resource.RetryContext(ctx, timeout, func() *resource.RetryError {
+		jobs, err := api.JobsActive(ctx)
+		if err != nil {
+			return resource.NonRetryableError(err)
+		}
+
+		var running []string
+		for jid, job := range jobs {
+			if job.RunningOn(minionId) {
+				running = append(running, fmt.Sprintf("%s (%s)", jid, job.Function))
+			}
+		}
+		if len(running) > 0 {
+			sort.Strings(running)
+			return resource.RetryableError(fmt.Errorf("The jobs %s still run on minion %s after %s.", strings.Join(running, ", "), minionId, timeout))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,477 @@
+package saltstack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/imperva/terraform-provider-saltstack/helper"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi"
+)
+
+// Key states as exposed by the resources, by bucket of the Salt Master PKI.
+var keyStates = map[string]string{
+	saltapi.KeyAccepted: "accepted",
+	saltapi.KeyPending:  "pending",
+	saltapi.KeyRejected: "rejected",
+	saltapi.KeyDenied:   "denied",
+}
+
+// The key states which can be configured. Pending and denied keys are
+// only reported, as the Salt Master puts keys in these buckets by itself.
+var settableKeyStates = []string{"accepted", "rejected"}
+
+func keyStateSchema(description string) *schema.Schema {
+	return &schema.Schema{
+		Type:             schema.TypeString,
+		Optional:         true,
+		Default:          "accepted",
+		Description:      description,
+		ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice(settableKeyStates, false)),
+	}
+}
+
+// readKey returns the state and the public key of a minion's key, from the first bucket holding it.
+// The state is empty if the minion has no key.
+func readKey(ctx context.Context, api *saltapi.Client, minionId string) (string, string, error) {
+	keys, err := api.KeyPrintMinions(ctx, []string{minionId})
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, bucket := range saltapi.KeyBuckets {
+		if publicKey, ok := keys[bucket][minionId]; ok {
+			return keyStates[bucket], publicKey, nil
+		}
+	}
+	return "", "", nil
+}
+
+// readSingleKey returns the bucket and the public key of the only key the Salt Master holds for a minion,
+// or an empty bucket if it holds none. Keys in several buckets fail, as the key the minion submitted can
+// not be told from the others, and moving one of them would replace another.
+func readSingleKey(ctx context.Context, meta *providerMeta, minionId string) (string, string, diag.Diagnostics) {
+	api := meta.api
+
+	keys, err := api.KeyPrintMinions(ctx, []string{minionId})
+	if err != nil {
+		return "", "", diag.FromErr(err)
+	}
+
+	var bucket, publicKey string
+	var found []string
+	for _, b := range saltapi.KeyBuckets {
+		key, ok := keys[b][minionId]
+		if !ok {
+			continue
+		}
+		if bucket == "" {
+			bucket, publicKey = b, key
+		}
+		fingerprint, _ := meta.SaltFingerprint(ctx, key)
+		found = append(found, fmt.Sprintf("%s (%s)", fingerprint, keyStates[b]))
+	}
+
+	if len(found) > 1 {
+		return "", "", diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  fmt.Sprintf("The Salt Master holds keys for minion %s in several buckets", minionId),
+			Detail:   fmt.Sprintf("The keys %s were submitted for the minion, so the key of the minion can not be told apart. Delete the keys which are not the minion's with `salt-key -d %s` before applying.", strings.Join(found, ", "), minionId),
+		}}
+	}
+	return bucket, publicKey, nil
+}
+
+// readManagedKey compares the keys the Salt Master holds for a minion against the managed public key.
+// It returns the state of the managed key and the key the Salt Master holds instead of it, which is the
+// managed key itself unless another key replaced it or was submitted next to it. The diagnostics
+// report the keys which differ. Without a managed key, e.g. on import, the first key found is managed.
+func readManagedKey(ctx context.Context, meta *providerMeta, minionId string, managedKey string) (string, string, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	api := meta.api
+
+	keys, err := api.KeyPrintMinions(ctx, []string{minionId})
+	if err != nil {
+		return "", "", diag.FromErr(err)
+	}
+
+	var state, masterKey, masterKeyState string
+	for _, bucket := range saltapi.KeyBuckets {
+		publicKey, ok := keys[bucket][minionId]
+		if !ok {
+			continue
+		}
+		if managedKey == "" {
+			managedKey = publicKey
+		}
+
+		if samePublicKey(publicKey, managedKey) {
+			if state == "" {
+				state = keyStates[bucket]
+			}
+			continue
+		}
+
+		fingerprint, _ := meta.SaltFingerprint(ctx, publicKey)
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("The Salt Master holds a different key for minion %s", minionId),
+			Detail:   fmt.Sprintf("A key with the fingerprint %s is %s on the Salt Master, it is not the key managed by Terraform. The managed key will be restored.", fingerprint, keyStates[bucket]),
+		})
+		if masterKey == "" {
+			masterKey = publicKey
+			masterKeyState = keyStates[bucket]
+		}
+	}
+
+	if state == "" {
+		// The managed key was replaced
+		state = masterKeyState
+	}
+	if masterKey == "" {
+		masterKey = managedKey
+	}
+	return state, masterKey, diags
+}
+
+// checkExistingKey checks, while planning a new key resource, whether the Salt Master already holds a key for
+// the minion, so that the plan fails instead of the apply, after other resources were changed. Any key fails
+// the plan, unless it is adopted: the accepted key is then kept, and the other keys are replaced by the apply.
+func checkExistingKey(ctx context.Context, api *saltapi.Client, minionId string, adopt bool) error {
+	keys, err := api.KeyListAll(ctx)
+	if err != nil {
+		return err
+	}
+	return checkExistingKeyIn(ctx, keys, minionId, adopt)
+}
+
+// checkExistingKeyIn is checkExistingKey on the keys listed by `key.list_all`, to check many minions at once.
+func checkExistingKeyIn(ctx context.Context, keys map[string][]string, minionId string, adopt bool) error {
+	for _, bucket := range saltapi.KeyBuckets {
+		found := false
+		for _, id := range keys[bucket] {
+			found = found || id == minionId
+		}
+		switch {
+		case !found:
+			continue
+		case adopt && bucket == saltapi.KeyAccepted:
+			tflog.Info(ctx, fmt.Sprintf("The accepted key of minion %s will be adopted", minionId), nil)
+		case adopt:
+			tflog.Info(ctx, fmt.Sprintf("The %s key of minion %s will be replaced", keyStates[bucket], minionId), nil)
+		case bucket == saltapi.KeyAccepted:
+			return fmt.Errorf("The minion %s is already in use: the Salt Master holds an accepted key for it. Import the key with `terraform import`, set adopt_existing if the resource supports it, or delete the key with `salt-key -d %s`.", minionId, minionId)
+		default:
+			return fmt.Errorf("The minion %s is already in use: the Salt Master holds a %s key for it, which the apply would replace. Set adopt_existing if the resource supports it, manage the key the minion submitted with saltstack_minion_key_state, or delete the key with `salt-key -d %s`.", minionId, keyStates[bucket], minionId)
+		}
+	}
+	return nil
+}
+
+// restoreManagedKey places the managed public key of a minion in the bucket of the given state, and
+// deletes the other keys the Salt Master holds for the minion.
+func restoreManagedKey(ctx context.Context, meta *providerMeta, minionId string, managedKey string, state string) diag.Diagnostics {
+	api := meta.api
+
+	target := saltapi.KeyAccepted
+	if state == "rejected" {
+		target = saltapi.KeyRejected
+	}
+
+	keys, err := api.KeyPrintMinions(ctx, []string{minionId})
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	tflog.Debug(ctx, fmt.Sprintf("Restoring the managed key of minion %s", minionId), nil)
+	if err := api.KeyWrite(ctx, target, minionId, managedKey); err != nil {
+		return diag.FromErr(err)
+	}
+
+	others := map[string][]string{}
+	for _, bucket := range saltapi.KeyBuckets {
+		if _, ok := keys[bucket][minionId]; ok && bucket != target {
+			others[bucket] = []string{minionId}
+		}
+	}
+	if len(others) > 0 {
+		if err := api.KeyDeleteDict(ctx, others); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	tflog.Debug(ctx, fmt.Sprintf("Restored the managed key of minion %s", minionId), nil)
+
+	return nil
+}
+
+// managedKeyBucket returns the first bucket holding the managed public key of a minion, or an empty
+// string if the Salt Master holds it nowhere.
+func managedKeyBucket(keys map[string]map[string]string, minionId string, managedKey string) string {
+	for _, bucket := range saltapi.KeyBuckets {
+		if publicKey, ok := keys[bucket][minionId]; ok && samePublicKey(publicKey, managedKey) {
+			return bucket
+		}
+	}
+	return ""
+}
+
+// applyKeyState accepts or rejects the managed key of a minion. Only the bucket holding it is moved, as Salt
+// moves the keys of every bucket it is given and the last one overwrites the others: the other keys the
+// Salt Master holds for the minion are left in place and reported.
+func applyKeyState(ctx context.Context, meta *providerMeta, minionId string, managedKey string, state string) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	api := meta.api
+
+	var target string
+	switch state {
+	case "accepted":
+		target = saltapi.KeyAccepted
+	case "rejected":
+		target = saltapi.KeyRejected
+	default:
+		return diag.Errorf("The key state %s can not be set.", state)
+	}
+
+	keys, err := api.KeyPrintMinions(ctx, []string{minionId})
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	from := managedKeyBucket(keys, minionId, managedKey)
+	if from == "" {
+		return diag.Errorf("The Salt Master does not hold the managed key of minion %s, so it can not be %s.", minionId, state)
+	}
+	if from == target {
+		return diags
+	}
+
+	tflog.Debug(ctx, fmt.Sprintf("Changing the key state of minion %s from %s to %s", minionId, keyStates[from], state), nil)
+	if state == "accepted" {
+		_, err = api.KeyAcceptMinions(ctx, from, []string{minionId})
+	} else {
+		_, err = api.KeyRejectMinions(ctx, from, []string{minionId})
+	}
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	tflog.Debug(ctx, fmt.Sprintf("Changed the key state of minion %s to %s", minionId, state), nil)
+
+	return otherKeysDiagnostics(ctx, meta, keys, minionId, from, target)
+}
+
+// otherKeysDiagnostics reports the keys of a minion which were not moved with its managed key: the key the
+// managed key replaced in the target bucket, and the keys left in the other buckets.
+func otherKeysDiagnostics(ctx context.Context, meta *providerMeta, keys map[string]map[string]string, minionId string, from string, target string) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	for _, bucket := range saltapi.KeyBuckets {
+		publicKey, ok := keys[bucket][minionId]
+		if !ok || bucket == from {
+			continue
+		}
+
+		fingerprint, _ := meta.SaltFingerprint(ctx, publicKey)
+		detail := fmt.Sprintf("The %s key with the fingerprint %s is not the managed key, it was left in place.", keyStates[bucket], fingerprint)
+		if bucket == target {
+			detail = fmt.Sprintf("The %s key with the fingerprint %s was replaced by the managed key.", keyStates[bucket], fingerprint)
+		}
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("The Salt Master holds another key for minion %s", minionId),
+			Detail:   detail,
+		})
+	}
+	return diags
+}
+
+func onDestroySchema(description string) *schema.Schema {
+	return &schema.Schema{
+		Type:             schema.TypeString,
+		Optional:         true,
+		Default:          "delete",
+		Description:      description,
+		ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice([]string{"delete", "reject", "abandon"}, false)),
+	}
+}
+
+func deletionProtectionSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeBool,
+		Optional:    true,
+		Default:     false,
+		Description: "Whether destroying or replacing the resource fails instead of applying `on_destroy`. It must be unset by an apply before the resource can be destroyed.",
+	}
+}
+
+// importMinionKey imports a key resource by minion ID, with the default destroy behaviour.
+func importMinionKey(ctx context.Context, d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	d.SetId(normalizeMinionId(m.(*providerMeta), d.Id()))
+	d.Set("on_destroy", "delete")
+	d.Set("deletion_protection", false)
+	return []*schema.ResourceData{d}, nil
+}
+
+// destroyKey applies the on_destroy behaviour of a key resource to the key of a minion: it deletes the
+// key from every bucket, rejects the managed key, or leaves it on the Salt Master. The deletion protection
+// prevents all of them.
+func destroyKey(ctx context.Context, meta *providerMeta, d *schema.ResourceData, minionId string, managedKey string) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	api := meta.api
+
+	if d.Get("deletion_protection").(bool) {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Error,
+			Summary:  fmt.Sprintf("The key of minion %s is protected from deletion", minionId),
+			Detail:   "deletion_protection is set, so the key was left on the Salt Master. Unset deletion_protection and apply before destroying the resource.",
+		})
+		return diags
+	}
+
+	// The keys are matched by exact minion ID, as `key.delete` and `key.reject` match globs
+	var destroyed map[string][]string
+	var err error
+	switch onDestroy := d.Get("on_destroy").(string); onDestroy {
+	case "abandon":
+		tflog.Info(ctx, fmt.Sprintf("Leaving the key of minion %s on the Salt Master", minionId), nil)
+		return diags
+	case "reject":
+		tflog.Debug(ctx, fmt.Sprintf("Rejecting the key of minion %s", minionId), nil)
+		var keys map[string]map[string]string
+		if keys, err = api.KeyPrintMinions(ctx, []string{minionId}); err != nil {
+			return diag.FromErr(err)
+		}
+		// Only the managed key is rejected, a key the Salt Master holds in another bucket would replace it
+		from := managedKeyBucket(keys, minionId, managedKey)
+		if from == "" || from == saltapi.KeyRejected {
+			break
+		}
+		destroyed, err = api.KeyRejectMinions(ctx, from, []string{minionId})
+		if err == nil {
+			diags = otherKeysDiagnostics(ctx, meta, keys, minionId, from, saltapi.KeyRejected)
+		}
+	default:
+		tflog.Debug(ctx, fmt.Sprintf("Deleting the key of minion %s", minionId), nil)
+		destroyed, err = api.KeyDeleteMinions(ctx, []string{minionId})
+	}
+	logDestroyedKeys(ctx, d.Get("on_destroy").(string), destroyed)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	return diags
+}
+
+// logDestroyedKeys logs the keys on_destroy deleted or rejected, by the bucket they were in.
+func logDestroyedKeys(ctx context.Context, onDestroy string, destroyed map[string][]string) {
+	if len(destroyed) == 0 {
+		tflog.Info(ctx, fmt.Sprintf("The Salt Master held no key to %s", onDestroy), nil)
+	}
+	for _, bucket := range saltapi.KeyBuckets {
+		if ids := destroyed[bucket]; len(ids) > 0 {
+			tflog.Info(ctx, fmt.Sprintf("Applied %s to the %s keys of %s", onDestroy, keyStates[bucket], strings.Join(ids, ", ")), nil)
+		}
+	}
+}
+
+func fingerprintSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeString,
+		Computed:    true,
+		Description: "The fingerprint of the minion's public key as Salt's `key.finger` and `salt-key -f` report it, using the `hash_type` of the provider.",
+	}
+}
+
+func fingerprintSha256Schema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeString,
+		Computed:    true,
+		Description: "The SHA256 fingerprint of the DER encoding of the minion's public key.",
+	}
+}
+
+// setKeyFingerprints computes the fingerprints of a public key locally, with the hash type of the provider or
+// the one detected on the Salt Master.
+func setKeyFingerprints(ctx context.Context, d *schema.ResourceData, meta *providerMeta, publicKey string) error {
+	fingerprint, err := meta.SaltFingerprint(ctx, publicKey)
+	if err != nil {
+		return err
+	}
+	fingerprintSha256, err := helper.Sha256Fingerprint(publicKey)
+	if err != nil {
+		return err
+	}
+
+	d.Set("fingerprint", fingerprint)
+	d.Set("fingerprint_sha256", fingerprintSha256)
+	return nil
+}
+
+// checkKeyFingerprint cross-checks the fingerprint computed locally against the one the Salt Master reports
+// for the key in the bucket of the given state.
+func checkKeyFingerprint(ctx context.Context, meta *providerMeta, minionId string, state string, fingerprint string) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	fingers, err := meta.api.KeyFingerMinion(ctx, minionId, "")
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	hashType, _ := meta.HashType(ctx)
+
+	for bucket, s := range keyStates {
+		if finger, ok := fingers[bucket][minionId]; ok && s == state && !sameFingerprint(finger, fingerprint) {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  fmt.Sprintf("The Salt Master reports a different fingerprint for minion %s", minionId),
+				Detail:   fmt.Sprintf("The Salt Master reports %s, the provider computed %s with the %s hash type. Check that the `hash_type` of the provider matches the one of the Salt Master.", finger, fingerprint, hashType),
+			})
+		}
+	}
+	return diags
+}
+
+// waitForKey polls the Salt Master until the minion submitted its key.
+func waitForKey(ctx context.Context, api *saltapi.Client, minionId string, timeout time.Duration) error {
+	tflog.Debug(ctx, fmt.Sprintf("Waiting for minion %s to submit its key", minionId), nil)
+	return resource.RetryContext(ctx, timeout, func() *resource.RetryError {
+		state, _, err := readKey(ctx, api, minionId)
+		if err != nil {
+			return resource.NonRetryableError(err)
+		}
+		if state == "" {
+			return resource.RetryableError(fmt.Errorf("The minion %s did not submit a key to the Salt Master within %s.", minionId, timeout))
+		}
+		return nil
+	})
+}
+
+// verifyFingerprint checks the fingerprint of the key a minion holds in a bucket, as reported by `key.finger`.
+func verifyFingerprint(ctx context.Context, api *saltapi.Client, minionId string, bucket string, expected string) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	fingers, err := api.KeyFingerMinion(ctx, minionId, "")
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if finger := fingers[bucket][minionId]; !sameFingerprint(finger, expected) {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Error,
+			Summary:  fmt.Sprintf("The key of minion %s does not match the expected fingerprint", minionId),
+			Detail:   fmt.Sprintf("The Salt Master reports the fingerprint %s, expected %s. The key was left %s.", finger, expected, keyStates[bucket]),
+		})
+	}
+	return diags
+}
+
+// sameFingerprint compares fingerprints regardless of the case of the hex digits.
+func sameFingerprint(a string, b string) bool {
+	return a != "" && strings.EqualFold(a, b)
+}
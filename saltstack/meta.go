@@ -0,0 +1,58 @@
+package saltstack
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/imperva/terraform-provider-saltstack/helper"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi"
+)
+
+// providerMeta is passed to the functions of the resources: the salt-api client, and the settings of the
+// provider which are not settings of the client.
+type providerMeta struct {
+	api *saltapi.Client
+
+	// The hash_type of the provider, empty when it is detected on the Salt Master.
+	hashType string
+	// A regular expression the minion IDs must match, on top of the rules of Salt.
+	minionIdPattern string
+	// Whether minion IDs are lowercased, like the minion_id_lowercase setting of the minions does.
+	minionIdLowercase bool
+
+	hashTypeMu       sync.Mutex
+	detectedHashType string
+}
+
+// HashType returns the hash_type of the provider, or the one of the Salt Master, read with `config.get`
+// the first time it is needed. A failed detection is not cached, so that the next call tries again.
+func (meta *providerMeta) HashType(ctx context.Context) (string, error) {
+	if meta.hashType != "" {
+		return meta.hashType, nil
+	}
+
+	meta.hashTypeMu.Lock()
+	defer meta.hashTypeMu.Unlock()
+
+	if meta.detectedHashType == "" {
+		hashType, err := meta.api.MasterHashType(ctx)
+		if err != nil {
+			return "", fmt.Errorf("The hash_type of the Salt Master could not be detected with `config.get`, which needs the @runner permission. Set the hash_type of the provider: %v", err)
+		}
+		if _, ok := helper.SaltHashTypes[hashType]; !ok {
+			return "", fmt.Errorf("The Salt Master uses the hash_type %q, which the provider does not support", hashType)
+		}
+		meta.detectedHashType = hashType
+	}
+	return meta.detectedHashType, nil
+}
+
+// SaltFingerprint returns the fingerprint of a public key as `salt-key -f` reports it.
+func (meta *providerMeta) SaltFingerprint(ctx context.Context, publicKey string) (string, error) {
+	hashType, err := meta.HashType(ctx)
+	if err != nil {
+		return "", err
+	}
+	return helper.SaltFingerprint(publicKey, hashType)
+}
@@ -2,11 +2,17 @@ package saltstack
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi"
 )
 
+// The oldest Salt Master release the provider is tested against.
+var minimumTestedSaltVersion = saltapi.MinimumSaltVersion
+
 // Provider -
 func Provider() *schema.Provider {
 	provider := &schema.Provider{
@@ -66,6 +72,45 @@ func Provider() *schema.Provider {
 				DefaultFunc: schema.EnvDefaultFunc("SALTSTACK_SSL_SKIP_VERIFY", false),
 				Description: "Skip SSL verification. Defaults to `false`",
 			},
+			"salt_version": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("SALTSTACK_SALT_VERSION", nil),
+				Description: "Salt Master version, e.g. `3004.2`. When not set, the version is detected through the `salt.cmd` runner the first time the plan of a resource needs it, which requires the API user to have `@runner` permissions. Without them, the features are assumed to be supported, and the apply of the resources reports a warning.",
+			},
+			"pki_dir": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("SALTSTACK_PKI_DIR", "/etc/salt/pki/master"),
+				Description: "The `pki_dir` of the Salt Master, where public keys supplied to the provider are placed by the `salt.cmd` runner. Defaults to `/etc/salt/pki/master`.",
+			},
+			"hash_type": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				DefaultFunc:      schema.EnvDefaultFunc("SALTSTACK_HASH_TYPE", nil),
+				Description:      "The `hash_type` of the Salt Master, used to compute the `fingerprint` of the keys as `salt-key -f` reports it. Can be `md5`, `sha1`, `sha224`, `sha256`, `sha384` or `sha512`. When not set, it is read from the Salt Master with `config.get` through the `salt.cmd` runner the first time a fingerprint is computed, which requires the API user to have `@runner` permissions.",
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice([]string{"md5", "sha1", "sha224", "sha256", "sha384", "sha512"}, false)),
+			},
+			"minion_id_pattern": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				DefaultFunc:      schema.EnvDefaultFunc("SALTSTACK_MINION_ID_PATTERN", ""),
+				Description:      "A regular expression the minion IDs of the resources must match, on top of the rules of Salt, which forbid `/`, `\\`, NUL characters, `.` and `..`, and of the provider, which forbids commas as the key functions of Salt split their match on them. E.g. `^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$` only allows RFC 1123 hostnames.",
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringIsValidRegExp),
+			},
+			"minion_id_lowercase": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("SALTSTACK_MINION_ID_LOWERCASE", false),
+				Description: "Lowercase the `minion_id` of the resources, like the `minion_id_lowercase` setting of the minions does, so that the keys are managed under the lowercased IDs and changing only the case of a `minion_id` plans nothing. `saltstack_minion_key_pairs` requires lowercase `minion_ids` instead. Defaults to `false`.",
+			},
+			"max_retries": {
+				Type:             schema.TypeInt,
+				Optional:         true,
+				DefaultFunc:      schema.EnvDefaultFunc("SALTSTACK_MAX_RETRIES", 3),
+				Description:      "How many times a salt-api call is retried, waiting 1s then twice as long at each retry, when salt-api can not be reached or the proxy in front of it answers 502 or 503. The calls which may have reached salt-api are never retried, as the key functions are not idempotent. Defaults to `3`.",
+				ValidateDiagFunc: validation.ToDiagFunc(validation.IntAtLeast(0)),
+			},
 			"debug": {
 				Type:        schema.TypeBool,
 				Optional:    true,
@@ -74,17 +119,68 @@ func Provider() *schema.Provider {
 			},
 		},
 		ResourcesMap: map[string]*schema.Resource{
-			"saltstack_minion_key_pair": resourceMinionAcceptedKeyPair(),
+			"saltstack_minion_key_pair":  resourceMinionAcceptedKeyPair(),
+			"saltstack_minion_key_pairs": resourceMinionKeyPairs(),
+			"saltstack_minion_key":       resourceMinionKey(),
+			"saltstack_minion_key_state": resourceMinionKeyState(),
+			"saltstack_minion_presence":  resourceMinionPresence(),
+
+			"saltstack_accepted_keys_exclusive": resourceAcceptedKeysExclusive(),
+		},
+		DataSourcesMap: map[string]*schema.Resource{
+			"saltstack_master_key":    dataSourceMasterKey(),
+			"saltstack_minion_config": dataSourceMinionConfig(),
 		},
 		ConfigureContextFunc: providerConfigure,
 	}
 
+	// Changing only the case of a minion ID plans nothing when minion_id_lowercase is set
+	for _, r := range provider.ResourcesMap {
+		if s, ok := r.Schema["minion_id"]; ok {
+			s.DiffSuppressFunc = suppressMinionIdCase(provider)
+		}
+	}
+
 	return provider
 }
 
+// keyFeatures are the wheel functions the key resources use to change the keys of exact minion IDs.
+var keyFeatures = []string{"key.accept_dict", "key.reject_dict", "key.delete_dict"}
+
+// customizeDiffFeatures fails the plan of a resource which is created or changed when the Salt Master is
+// too old for one of the features its apply uses.
+func customizeDiffFeatures(ctx context.Context, d *schema.ResourceDiff, api *saltapi.Client, features ...string) error {
+	if d.Id() != "" && len(d.GetChangedKeysPrefix("")) == 0 {
+		return nil
+	}
+	for _, feature := range features {
+		if err := api.CheckFeature(ctx, feature); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// warnUndetectedVersion reports a warning from the apply of a resource whose plan could not check the
+// features it uses, as the Salt Master version could not be detected. The plan can not report it, as
+// CustomizeDiff has no diagnostics.
+func warnUndetectedVersion(f func(context.Context, *schema.ResourceData, interface{}) diag.Diagnostics) func(context.Context, *schema.ResourceData, interface{}) diag.Diagnostics {
+	return func(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+		var diags diag.Diagnostics
+		if _, err := m.(*providerMeta).api.SaltVersion(ctx); err != nil {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  "Unable to detect the Salt Master version",
+				Detail:   fmt.Sprintf("%v. The features the resource uses are assumed to be supported, set the salt_version of the provider to check them.", err),
+			})
+		}
+		return append(diags, f(ctx, d, m)...)
+	}
+}
+
 func providerConfigure(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
 
-	config := Config{
+	config := saltapi.Config{
 		Host:          d.Get("host").(string),
 		Port:          d.Get("port").(int),
 		Scheme:        d.Get("scheme").(string),
@@ -95,14 +191,38 @@ func providerConfigure(ctx context.Context, d *schema.ResourceData) (interface{}
 		UseToken:      d.Get("use_token").(bool),
 		Debug:         d.Get("debug").(bool),
 		SSLSkipVerify: d.Get("ssl_skip_verify").(bool),
+		SaltVersion:   d.Get("salt_version").(string),
+		PKIDir:        d.Get("pki_dir").(string),
+		MaxRetries:    d.Get("max_retries").(int),
 	}
 
 	var diags diag.Diagnostics
 
-	c, err := NewClient(config)
+	c, err := saltapi.NewClient(config)
 	if err != nil {
 		return nil, diag.FromErr(err)
 	}
 
-	return c, diags
+	// A detected version is only checked by the plans which need it, so that the provider does not call
+	// the runner client, which needs the @runner permission, for every plan
+	if config.SaltVersion != "" {
+		version, err := c.SaltVersion(ctx)
+		if err != nil {
+			return nil, diag.FromErr(err)
+		}
+		if !version.AtLeast(minimumTestedSaltVersion) {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  "Unsupported Salt Master version",
+				Detail:   fmt.Sprintf("The Salt Master runs %s, the provider is tested with %s and newer.", version, minimumTestedSaltVersion),
+			})
+		}
+	}
+
+	return &providerMeta{
+		api:               c,
+		hashType:          d.Get("hash_type").(string),
+		minionIdPattern:   d.Get("minion_id_pattern").(string),
+		minionIdLowercase: d.Get("minion_id_lowercase").(bool),
+	}, diags
 }
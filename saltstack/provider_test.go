@@ -1,15 +1,32 @@
 package saltstack
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"regexp"
+	"strings"
 	"testing"
 
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi/saltapitest"
 )
 
 var testAccProviders map[string]*schema.Provider
 var testAccProvider *schema.Provider
 
+// testUnitProviderFactories do not add an empty provider block to the configuration,
+// so that the tests can configure the provider against a salt-api emulator.
+var testUnitProviderFactories = map[string]func() (*schema.Provider, error){
+	"saltstack": func() (*schema.Provider, error) {
+		return Provider(), nil
+	},
+}
+
 func init() {
 	testAccProvider = Provider()
 	testAccProviders = map[string]*schema.Provider{
@@ -27,6 +44,94 @@ func TestProvider_impl(t *testing.T) {
 	var _ *schema.Provider = Provider()
 }
 
+func TestProvider_unsupportedFeature(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	server.Version = "2019.2.8"
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      testUnitProviderConfig(server) + testKeyPairConfig{MinionId: "test-1.domain.com", KeySize: 2048}.render(),
+				ExpectError: regexp.MustCompile(`key.gen_accept requires Salt Master 3002 or newer, the Salt Master runs 2019.2.8`),
+			},
+			{
+				Config:      testUnitProviderConfig(server) + testCheckSaltstackMinionKeyStateConfig("test-1.domain.com", "accepted"),
+				ExpectError: regexp.MustCompile(`key.accept_dict requires Salt Master 3002 or newer`),
+			},
+		},
+	})
+}
+
+func TestProvider_versionDetection(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+	server.SetKey(saltapitest.Pending, "test-1.domain.com", publicKey)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				// The version is not detected by plans which do not need it
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMasterKeyConfig(),
+				Check: func(*terraform.State) error {
+					for _, call := range server.CallsTo("runner", "salt.cmd") {
+						if fmt.Sprint(call["arg"]) == "[test.version]" {
+							return fmt.Errorf("expected the version not to be detected")
+						}
+					}
+					return nil
+				},
+			},
+			{
+				// The features are assumed to be supported without the @runner permission, with which the
+				// hash_type must be set
+				PreConfig: func() {
+					server.Perms = []string{"@wheel"}
+					t.Setenv("SALTSTACK_HASH_TYPE", "sha256")
+				},
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMinionKeyStateConfig("test-1.domain.com", "accepted"),
+				Check:  testCheckSaltstackMinionKeyBucket(server, "test-1.domain.com", saltapitest.Accepted),
+			},
+		},
+	})
+}
+
+func TestWarnUndetectedVersion(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	server.Perms = []string{"@wheel"}
+	api, err := saltapi.NewClient(saltapi.Config{
+		Host:     server.Host(),
+		Port:     server.Port(),
+		Scheme:   "http",
+		Username: server.Username,
+		Password: server.Password,
+		Eauth:    server.Eauth,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := &providerMeta{api: api}
+	d := schema.TestResourceDataRaw(t, resourceMinionKeyState().Schema, map[string]interface{}{})
+	apply := warnUndetectedVersion(func(context.Context, *schema.ResourceData, interface{}) diag.Diagnostics {
+		return diag.Errorf("The apply failed")
+	})
+
+	diags := apply(context.Background(), d, meta)
+	if len(diags) != 2 || diags[0].Severity != diag.Warning || diags[0].Summary != "Unable to detect the Salt Master version" {
+		t.Fatalf("Without the @runner permission, the apply does not report the version as undetected: %v", diags)
+	}
+	if diags[1].Summary != "The apply failed" {
+		t.Fatalf("The diagnostics of the apply are not kept: %v", diags)
+	}
+
+	// The detection is tried again, as its failure is not cached
+	server.Perms = []string{"@wheel", "@runner"}
+	if diags := apply(context.Background(), d, meta); len(diags) != 1 {
+		t.Fatalf("Once the version is detected, the apply still reports it as undetected: %v", diags)
+	}
+}
+
 func testAccPreCheck(t *testing.T) {
 	if err := os.Getenv("SALTSTACK_HOST"); err == "" {
 		t.Fatal("SALTSTACK_HOST must be set for acceptance tests")
@@ -41,3 +146,48 @@ func testAccPreCheck(t *testing.T) {
 		t.Fatal("SALTSTACK_PASSWORD must be set for acceptance tests")
 	}
 }
+
+// testUnitProviderConfig configures the provider against a salt-api emulator.
+func testUnitProviderConfig(s *saltapitest.Server) string {
+	return fmt.Sprintf(`
+	provider saltstack {
+		host = "%s"
+		port = %d
+		scheme = "http"
+		username = "%s"
+		password = "%s"
+		eauth = "%s"
+	}
+	`, s.Host(), s.Port(), s.Username, s.Password, s.Eauth)
+}
+
+// testUnitProviderConfigMinionId configures the provider of the emulator with the minion ID settings.
+func testUnitProviderConfigMinionId(s *saltapitest.Server, pattern string, lowercase bool) string {
+	return fmt.Sprintf(`
+	provider saltstack {
+		host = "%s"
+		port = %d
+		scheme = "http"
+		username = "%s"
+		password = "%s"
+		eauth = "%s"
+		minion_id_pattern = "%s"
+		minion_id_lowercase = %t
+	}
+	`, s.Host(), s.Port(), s.Username, s.Password, s.Eauth, strings.ReplaceAll(pattern, `\`, `\\`), lowercase)
+}
+
+// testReplayProviderConfig configures the provider with the credentials of the Makefile,
+// which are used to record salt-api interactions.
+func testReplayProviderConfig() string {
+	return `
+	provider saltstack {
+		host = "salt-master.invalid"
+		port = 8000
+		scheme = "http"
+		username = "username"
+		password = "password"
+		eauth = "sharedsecret"
+	}
+	`
+}
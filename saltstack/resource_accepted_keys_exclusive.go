@@ -0,0 +1,266 @@
+package saltstack
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/imperva/terraform-provider-saltstack/pkg/fnmatch"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi"
+)
+
+func resourceAcceptedKeysExclusive() *schema.Resource {
+	return &schema.Resource{
+		Description:   "Makes a list of minions the only ones accepted by the Salt Master. The accepted keys of other minions, the extra keys, are rejected or deleted. Destroying the resource leaves the keys as they are.",
+		CreateContext: traceResourceFunc("saltstack_accepted_keys_exclusive.Create", warnUndetectedVersion(resourceAcceptedKeysExclusiveCreate)),
+		ReadContext:   traceResourceFunc("saltstack_accepted_keys_exclusive.Read", resourceAcceptedKeysExclusiveRead),
+		UpdateContext: traceResourceFunc("saltstack_accepted_keys_exclusive.Update", warnUndetectedVersion(resourceAcceptedKeysExclusiveUpdate)),
+		DeleteContext: traceResourceFunc("saltstack_accepted_keys_exclusive.Delete", resourceAcceptedKeysExclusiveDelete),
+		CustomizeDiff: resourceAcceptedKeysExclusiveCustomizeDiff,
+		Schema: map[string]*schema.Schema{
+			"minion_ids": {
+				Type:        schema.TypeSet,
+				Required:    true,
+				Description: "The IDs of the minions which may be accepted. The resource does not accept their keys, the key resources do.",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"match": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Description:      "A glob which limits the accepted keys the resource manages, e.g. `web-*`. Defaults to `*`, all the accepted keys.",
+				Default:          "*",
+				ValidateDiagFunc: validateGlob,
+			},
+			"protected": {
+				Type:        schema.TypeSet,
+				Optional:    true,
+				Description: "Globs of minion IDs whose keys are never rejected nor deleted, e.g. the syndics, matched as Salt matches globs with `fnmatch`: `*` also matches `/`, and `[!...]` negates a set.",
+				Elem: &schema.Schema{
+					Type:             schema.TypeString,
+					ValidateDiagFunc: validateGlob,
+				},
+			},
+			"protect_master": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Never reject nor delete the keys of the Salt Master itself: its `id`, which the syndic running on it uses, and its `fqdn` and `host` grains, which the minion running on it usually uses. They are read with the `salt.cmd` runner, which needs the `@runner` permission. The other keys matching `match` which are neither in `minion_ids` nor `protected` are removed.",
+			},
+			"action": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Description:      "What to do with the extra keys: `reject`, which is the default and can be undone with `salt-key -a`, or `delete`.",
+				Default:          "reject",
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice([]string{"reject", "delete"}, false)),
+			},
+			"dry_run": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Only report the extra keys as warnings, without rejecting nor deleting them.",
+			},
+			"extra_keys": {
+				Type:        schema.TypeSet,
+				Computed:    true,
+				Description: "The minions whose keys are accepted although they are not in `minion_ids`, as of the last refresh.",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"removed_keys": {
+				Type:        schema.TypeSet,
+				Computed:    true,
+				Description: "The minions whose keys the last apply rejected or deleted. The plan lists the ones the apply is going to reject or delete.",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+func resourceAcceptedKeysExclusiveCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	d.SetId(resource.PrefixedUniqueId("accepted-keys-exclusive-"))
+	return resourceAcceptedKeysExclusiveUpdate(ctx, d, m)
+}
+
+func resourceAcceptedKeysExclusiveRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	meta := m.(*providerMeta)
+	api := meta.api
+
+	extraKeys, err := readExtraKeys(ctx, api, d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.Set("extra_keys", extraKeys)
+
+	if d.Get("dry_run").(bool) && len(extraKeys) > 0 {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("The Salt Master accepts the keys of %d minions which are not in minion_ids", len(extraKeys)),
+			Detail:   fmt.Sprintf("Without dry_run, the action %s would apply to: %s.", d.Get("action"), strings.Join(extraKeys, ", ")),
+		})
+	}
+
+	return diags
+}
+
+func resourceAcceptedKeysExclusiveUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	meta := m.(*providerMeta)
+	api := meta.api
+
+	if d.Get("dry_run").(bool) {
+		return resourceAcceptedKeysExclusiveRead(ctx, d, m)
+	}
+
+	extraKeys, err := readExtraKeys(ctx, api, d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// Only the extra keys listed by the plan are removed, the keys accepted since then are planned by the
+	// next one. When the plan could not list them, all the extra keys are.
+	targets := extraKeys
+	if d.GetRawPlan().GetAttr("removed_keys").IsWhollyKnown() {
+		planned := d.Get("removed_keys").(*schema.Set)
+		targets = nil
+		for _, id := range extraKeys {
+			if planned.Contains(id) {
+				targets = append(targets, id)
+			}
+		}
+	}
+
+	// removed_keys only lists the accepted keys the Salt Master actually removed, even when the action
+	// failed for some of them
+	removedKeys := []string{}
+	if len(targets) > 0 {
+		action := d.Get("action").(string)
+		tflog.Debug(ctx, fmt.Sprintf("Applying the action %s to the extra keys of %s", action, strings.Join(targets, ", ")), nil)
+		var removed map[string][]string
+		if action == "delete" {
+			removed, err = api.KeyDeleteMinions(ctx, targets)
+		} else {
+			removed, err = api.KeyRejectMinions(ctx, saltapi.KeyAccepted, targets)
+		}
+		logDestroyedKeys(ctx, action, removed)
+		removedKeys = append(removedKeys, removed[saltapi.KeyAccepted]...)
+		sort.Strings(removedKeys)
+		if err != nil {
+			d.Set("removed_keys", removedKeys)
+			return diag.FromErr(err)
+		}
+	}
+	d.Set("removed_keys", removedKeys)
+
+	return resourceAcceptedKeysExclusiveRead(ctx, d, m)
+}
+
+func resourceAcceptedKeysExclusiveDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	// The keys are left as they are
+	tflog.Debug(ctx, "Removing the exclusive management of the accepted keys from the state", nil)
+	return diags
+}
+
+func resourceAcceptedKeysExclusiveCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if err := customizeDiffFeatures(ctx, d, m.(*providerMeta).api, "key.reject_dict", "key.delete_dict"); err != nil {
+		return err
+	}
+
+	if d.Get("dry_run").(bool) {
+		if d.HasChanges("minion_ids", "match", "protected", "protect_master", "dry_run") {
+			return d.SetNewComputed("extra_keys")
+		}
+		return nil
+	}
+
+	for _, key := range []string{"minion_ids", "match", "protected", "protect_master"} {
+		if !d.NewValueKnown(key) {
+			if err := d.SetNewComputed("extra_keys"); err != nil {
+				return err
+			}
+			return d.SetNewComputed("removed_keys")
+		}
+	}
+
+	// Plan the extra keys the apply is going to remove
+	extraKeys, err := readExtraKeys(ctx, m.(*providerMeta).api, d)
+	if err != nil {
+		return err
+	}
+	if len(extraKeys) > 0 || d.Id() == "" {
+		if err := d.SetNewComputed("extra_keys"); err != nil {
+			return err
+		}
+		return d.SetNew("removed_keys", extraKeys)
+	}
+	return nil
+}
+
+// readExtraKeys returns the sorted minion IDs of the accepted keys which match the scope of the resource
+// but are neither listed nor protected, nor keys of the Salt Master itself with protect_master.
+func readExtraKeys(ctx context.Context, api *saltapi.Client, d interface{ Get(string) interface{} }) ([]string, error) {
+	keys, err := api.KeyListAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	minionIds := d.Get("minion_ids").(*schema.Set)
+	protected := d.Get("protected").(*schema.Set).List()
+	match := d.Get("match").(string)
+
+	masterIds := map[string]bool{}
+	if d.Get("protect_master").(bool) {
+		ids, err := api.MasterMinionIds(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("The minion IDs of the Salt Master could not be read to protect its keys, set protect_master to false to skip it: %v", err)
+		}
+		for _, id := range ids {
+			masterIds[id] = true
+		}
+	}
+
+	extraKeys := []string{}
+	for _, id := range keys[saltapi.KeyAccepted] {
+		matched, err := fnmatch.Match(match, id)
+		if err != nil {
+			return nil, fmt.Errorf("The glob %s of match is wrong: %v", match, err)
+		}
+		if !matched || minionIds.Contains(id) {
+			continue
+		}
+		if masterIds[id] {
+			tflog.Debug(ctx, fmt.Sprintf("The key of minion %s is the key of the Salt Master", id), nil)
+			continue
+		}
+		protected, err := isProtected(id, protected)
+		if err != nil {
+			return nil, err
+		}
+		if protected {
+			tflog.Debug(ctx, fmt.Sprintf("The key of minion %s is protected", id), nil)
+			continue
+		}
+		extraKeys = append(extraKeys, id)
+	}
+	sort.Strings(extraKeys)
+	return extraKeys, nil
+}
+
+func isProtected(minionId string, protected []interface{}) (bool, error) {
+	for _, glob := range protected {
+		matched, err := fnmatch.Match(glob.(string), minionId)
+		if err != nil {
+			return false, fmt.Errorf("The glob %s of protected is wrong: %v", glob, err)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
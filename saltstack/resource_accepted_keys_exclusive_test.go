@@ -0,0 +1,240 @@
+package saltstack
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi/saltapitest"
+)
+
+func TestSaltstackAcceptedKeysExclusive_lifecycle(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	resourceName := "saltstack_accepted_keys_exclusive.test"
+	for _, id := range []string{"web-1.domain.com", "web-2.domain.com", "rogue-1.domain.com", "salt.domain.com"} {
+		_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+		server.SetKey(saltapitest.Accepted, id, publicKey)
+	}
+	_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		// The keys are left as they are
+		CheckDestroy: testCheckSaltstackMinionKeyBucket(server, "web-1.domain.com", saltapitest.Accepted),
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackAcceptedKeysExclusiveConfig("*", "reject", true),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "extra_keys.#", "1"),
+					resource.TestCheckTypeSetElemAttr(resourceName, "extra_keys.*", "rogue-1.domain.com"),
+					testCheckSaltstackMinionKeyBucket(server, "rogue-1.domain.com", saltapitest.Accepted),
+				),
+			},
+			{
+				Config:             testUnitProviderConfig(server) + testCheckSaltstackAcceptedKeysExclusiveConfig("*", "reject", false),
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackAcceptedKeysExclusiveConfig("*", "reject", false),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "extra_keys.#", "0"),
+					resource.TestCheckResourceAttr(resourceName, "removed_keys.#", "1"),
+					resource.TestCheckTypeSetElemAttr(resourceName, "removed_keys.*", "rogue-1.domain.com"),
+					testCheckSaltstackMinionKeyBucket(server, "rogue-1.domain.com", saltapitest.Rejected),
+					testCheckSaltstackMinionKeyBucket(server, "web-1.domain.com", saltapitest.Accepted),
+					testCheckSaltstackMinionKeyBucket(server, "salt.domain.com", saltapitest.Accepted),
+				),
+			},
+			{
+				Config:   testUnitProviderConfig(server) + testCheckSaltstackAcceptedKeysExclusiveConfig("*", "reject", false),
+				PlanOnly: true,
+			},
+			{
+				// Another key is accepted outside of Terraform
+				PreConfig: func() {
+					server.SetKey(saltapitest.Accepted, "rogue-2.domain.com", publicKey)
+				},
+				Config:             testUnitProviderConfig(server) + testCheckSaltstackAcceptedKeysExclusiveConfig("*", "delete", false),
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackAcceptedKeysExclusiveConfig("*", "delete", false),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "removed_keys.#", "1"),
+					resource.TestCheckTypeSetElemAttr(resourceName, "removed_keys.*", "rogue-2.domain.com"),
+					testCheckSaltstackMinionKeyPairsDestroyed(server, []string{"rogue-2.domain.com"}),
+					testCheckSaltstackMinionKeyBucket(server, "rogue-1.domain.com", saltapitest.Rejected),
+				),
+			},
+		},
+	})
+}
+
+func TestSaltstackAcceptedKeysExclusive_match(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	resourceName := "saltstack_accepted_keys_exclusive.test"
+	for _, id := range []string{"web-1.domain.com", "web-9.domain.com", "db-1.domain.com"} {
+		_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+		server.SetKey(saltapitest.Accepted, id, publicKey)
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackAcceptedKeysExclusiveConfig("web-*", "delete", false),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "removed_keys.#", "1"),
+					resource.TestCheckTypeSetElemAttr(resourceName, "removed_keys.*", "web-9.domain.com"),
+					testCheckSaltstackMinionKeyPairsDestroyed(server, []string{"web-9.domain.com"}),
+					testCheckSaltstackMinionKeyBucket(server, "db-1.domain.com", saltapitest.Accepted),
+				),
+			},
+		},
+	})
+}
+
+func TestSaltstackAcceptedKeysExclusive_partialFailure(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	keys := map[string]string{}
+	for _, id := range []string{"web-1.domain.com", "web-8.domain.com", "web-9.domain.com"} {
+		_, keys[id], _ = saltapitest.GenerateKeyPair(2048)
+		server.SetKey(saltapitest.Accepted, id, keys[id])
+	}
+
+	// The Salt Master only rejects one of the extra keys
+	server.Handle("wheel", "key.reject_dict", func(s *saltapitest.Server, low saltapitest.Lowstate) (interface{}, error) {
+		s.SetKey(saltapitest.Rejected, "web-8.domain.com", keys["web-8.domain.com"])
+		return map[string][]string{saltapitest.Rejected: {"web-8.domain.com"}}, nil
+	})
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		// The destroy leaves the keys as they are
+		CheckDestroy: resource.ComposeTestCheckFunc(
+			testCheckSaltstackMinionKeyBucket(server, "web-8.domain.com", saltapitest.Rejected),
+			testCheckSaltstackMinionKeyBucket(server, "web-9.domain.com", saltapitest.Accepted),
+		),
+		Steps: []resource.TestStep{
+			{
+				Config:      testUnitProviderConfig(server) + testCheckSaltstackAcceptedKeysExclusiveConfig("web-*", "reject", false),
+				ExpectError: regexp.MustCompile(`did not reject the keys of web-9\.domain\.com \(minions\)`),
+			},
+		},
+	})
+}
+
+func TestSaltstackAcceptedKeysExclusive_invalidGlob(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      testUnitProviderConfig(server) + testCheckSaltstackAcceptedKeysExclusiveConfig("web-[9-0]", "reject", false),
+				ExpectError: regexp.MustCompile("The value must be a glob of minion IDs"),
+			},
+			{
+				Config: testUnitProviderConfig(server) + `
+				resource saltstack_accepted_keys_exclusive test {
+					minion_ids = ["web-1.domain.com"]
+					protected  = ["salt.domain.com", "syndic-[z-a]"]
+				}
+				`,
+				ExpectError: regexp.MustCompile("The value must be a glob of minion IDs"),
+			},
+		},
+	})
+}
+
+// TestSaltstackAcceptedKeysExclusive_fnmatch matches the globs as Salt does, which path.Match does not.
+func TestSaltstackAcceptedKeysExclusive_fnmatch(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	resourceName := "saltstack_accepted_keys_exclusive.test"
+	for _, id := range []string{"web-1.domain.com", "web-2.domain.com", "web-3.domain.com", "web-[4].domain.com", "syndic-1.domain.com"} {
+		_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+		server.SetKey(saltapitest.Accepted, id, publicKey)
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				// `[!1]` negates the set, and a `[` without a closing `]` is a literal character
+				Config: testUnitProviderConfig(server) + `
+				resource saltstack_accepted_keys_exclusive test {
+					minion_ids = ["web-3.domain.com"]
+					match      = "*-[!1]*"
+					protected  = ["web-[4*", "syndic-*"]
+					dry_run    = true
+				}
+				`,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "extra_keys.#", "1"),
+					resource.TestCheckTypeSetElemAttr(resourceName, "extra_keys.*", "web-2.domain.com"),
+				),
+			},
+		},
+	})
+}
+
+// TestSaltstackAcceptedKeysExclusive_protectMaster never removes the keys of the Salt Master itself by default.
+func TestSaltstackAcceptedKeysExclusive_protectMaster(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	resourceName := "saltstack_accepted_keys_exclusive.test"
+	for _, id := range []string{"web-1.domain.com", "salt.domain.com", "salt.domain.com_master", "salt"} {
+		_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+		server.SetKey(saltapitest.Accepted, id, publicKey)
+	}
+	config := func(protectMaster bool) string {
+		return testUnitProviderConfig(server) + fmt.Sprintf(`
+		resource saltstack_accepted_keys_exclusive test {
+			minion_ids     = ["web-1.domain.com"]
+			protect_master = %t
+			dry_run        = true
+		}
+		`, protectMaster)
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config(true),
+				Check:  resource.TestCheckResourceAttr(resourceName, "extra_keys.#", "0"),
+			},
+			{
+				Config: config(false),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "extra_keys.#", "3"),
+					resource.TestCheckTypeSetElemAttr(resourceName, "extra_keys.*", "salt"),
+					resource.TestCheckTypeSetElemAttr(resourceName, "extra_keys.*", "salt.domain.com"),
+					resource.TestCheckTypeSetElemAttr(resourceName, "extra_keys.*", "salt.domain.com_master"),
+				),
+			},
+			{
+				// The keys of the Salt Master can not be told apart without the @runner permission
+				PreConfig: func() {
+					server.Perms = []string{"@wheel"}
+				},
+				Config:      config(true),
+				ExpectError: regexp.MustCompile("set protect_master to false"),
+			},
+		},
+	})
+}
+
+func testCheckSaltstackAcceptedKeysExclusiveConfig(match string, action string, dryRun bool) string {
+	return fmt.Sprintf(`
+	resource saltstack_accepted_keys_exclusive test {
+		minion_ids = ["web-1.domain.com", "web-2.domain.com", "web-3.domain.com"]
+		match      = "%s"
+		protected  = ["salt.domain.com", "syndic-*"]
+		action     = "%s"
+		dry_run    = %t
+	}
+	`, match, action, dryRun)
+}
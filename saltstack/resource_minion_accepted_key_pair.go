@@ -2,67 +2,94 @@ package saltstack
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"regexp"
+	"os"
+	"path/filepath"
+	"time"
 
-	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-log/tflog"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/imperva/terraform-provider-saltstack/helper"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi"
 )
 
-type KeyPairCreateResult struct {
-	Return []struct {
-		Data struct {
-			Return map[string]string `json:"return"`
-		} `json:"data"`
-	} `json:"return"`
-}
-
-type KeyPairReadResult struct {
-	Return []struct {
-		Data struct {
-			Return struct {
-				Minions map[string]string `json:"minions"`
-			} `json:"return"`
-		} `json:"data"`
-	} `json:"return"`
-}
+// now is replaced in tests to simulate the passing of time.
+var now = time.Now
 
 func resourceMinionAcceptedKeyPair() *schema.Resource {
 	return &schema.Resource{
-		CreateContext: resourceMinionAcceptedKeyPairCreate,
-		ReadContext:   resourceMinionAcceptedKeyPairRead,
-		DeleteContext: resourceMinionAcceptedKeyPairDelete,
+		CreateContext: traceResourceFunc("saltstack_minion_key_pair.Create", warnUndetectedVersion(resourceMinionAcceptedKeyPairCreate)),
+		ReadContext:   traceResourceFunc("saltstack_minion_key_pair.Read", resourceMinionAcceptedKeyPairRead),
+		UpdateContext: traceResourceFunc("saltstack_minion_key_pair.Update", warnUndetectedVersion(resourceMinionAcceptedKeyPairUpdate)),
+		DeleteContext: traceResourceFunc("saltstack_minion_key_pair.Delete", resourceMinionAcceptedKeyPairDelete),
+		CustomizeDiff: resourceMinionAcceptedKeyPairCustomizeDiff,
 		Schema: map[string]*schema.Schema{
 			"minion_id": {
-				Type:        schema.TypeString,
-				Required:    true,
-				Description: "The ID of SaltStack minion.",
-				ForceNew:    true,
-				ValidateDiagFunc: func(v any, p cty.Path) diag.Diagnostics {
-					value := v.(string)
-					var diags diag.Diagnostics
-					if matched, _ := regexp.MatchString("^[a-zA-Z0-9.-]+$", value); !matched {
-						diag := diag.Diagnostic{
-							Severity: diag.Error,
-							Summary:  "Wrong value",
-							Detail:   fmt.Sprintf("minion_id must be a valid RFC1123 hostname, the value %s is wrong.", value),
-						}
-						diags = append(diags, diag)
-					}
-					return diags
-				},
+				Type:             schema.TypeString,
+				Required:         true,
+				Description:      "The ID of SaltStack minion. When `minion_id_lowercase` is set on the provider, the key is managed under the lowercased ID, and changing only the case of `minion_id` plans nothing.",
+				ForceNew:         true,
+				ValidateDiagFunc: validateMinionId,
 			},
 			"key_size": {
 				Type:        schema.TypeInt,
 				Optional:    true,
-				Description: "The size of the key pair to generate. The size must be 2048, which is the default, or greater. If set to a value less than 2048, the key size will be rounded up to 2048.",
+				Description: "The size of the key pair to generate. The size must be 2048, which is the default, or greater. If set to a value less than 2048, the key size will be rounded up to 2048. Changing it rotates the key pair.",
 				Default:     2048,
-				ForceNew:    true,
+			},
+			"key_generation": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Description:      "Where the key pair is generated: `master`, which is the default, generates it on the Salt Master with `key.gen_accept` and sends the private key back over the API, `local` generates it in the provider and only sends the public key to the Salt Master for acceptance, writing it into the `pki_dir` with the `salt.cmd` runner, which needs the root-equivalent `@runner` permission. Changing it rotates the key pair.",
+				Default:          "master",
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice([]string{"master", "local"}, false)),
+			},
+			"state": keyStateSchema("The state of the minion's key: `accepted`, which is the default, or `rejected`. Changing the state accepts or rejects the key in place. When the Salt Master moved the key to another bucket, the state reports it as `pending` or `denied`."),
+			"rotation_days": {
+				Type:             schema.TypeInt,
+				Optional:         true,
+				Description:      "The number of days after which the key pair is rotated. The plan shows the rotation once it is due. Not set or 0 never rotates the key pair.",
+				ValidateDiagFunc: validation.ToDiagFunc(validation.IntAtLeast(0)),
+			},
+			"rotation_triggers": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Description: "Arbitrary map of values that, when changed, rotates the key pair.",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"rotated_at": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The time, in RFC3339 format, at which the key pair was generated. Empty for an imported key pair, which `rotation_days` rotates on the next apply as its age is unknown.",
+			},
+			"private_key_storage": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Description:      "How the minion's private key is kept in the Terraform state: `state`, which is the default, keeps it in plain text, `encrypted` keeps it only in `private_key_encrypted`, and `none` never keeps it in the state, and only writes it to `private_key_file` when the key pair is generated. Changing it applies to the private key the state holds in plain text, otherwise to the next rotation of the key pair.",
+				Default:          "state",
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice([]string{"state", "none", "encrypted"}, false)),
+			},
+			"private_key_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The path of a file, only readable by its owner, the provider writes the minion's private key PEM to when `private_key_storage` is `none`, e.g. for a provisioner to copy it to the minion. It is written by the apply which generates or rotates the key pair, the state never holds the private key. Required when `private_key_storage` is `none`.",
+			},
+			"private_key_recipients": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "The public keys the private key is encrypted to when `private_key_storage` is `encrypted`: age public keys, e.g. `age1...`, or armored PGP public keys, but not both.",
+				Elem: &schema.Schema{
+					Type:             schema.TypeString,
+					ValidateDiagFunc: validateKeyRecipient,
+				},
+			},
+			"private_key_encrypted": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Minion's private key in PEM format, encrypted to the `private_key_recipients` when `private_key_storage` is `encrypted`: an armored age file, to decrypt with `age --decrypt`, or an armored PGP message, to decrypt with `gpg --decrypt`.",
 			},
 			"private_key": {
 				Type:        schema.TypeString,
@@ -70,15 +97,53 @@ func resourceMinionAcceptedKeyPair() *schema.Resource {
 				Description: "Minion's private key.",
 				Sensitive:   true,
 			},
+			"private_key_pkcs8": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Minion's private key in PKCS#8 PEM format.",
+				Sensitive:   true,
+			},
+			"private_key_openssh": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Minion's private key in OpenSSH format.",
+				Sensitive:   true,
+			},
+			"private_key_base64": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Minion's private key PEM, base64 encoded on a single line, e.g. for the `encoding: b64` files of cloud-init.",
+				Sensitive:   true,
+			},
+			"private_key_available": {
+				Type:        schema.TypeBool,
+				Computed:    true,
+				Description: "Whether the state holds the minion's private key, in `private_key` or `private_key_encrypted` depending on `private_key_storage`. It is `false` for imported key pairs, as the Salt Master does not keep the private keys it generates.",
+			},
 			"public_key": {
 				Type:        schema.TypeString,
 				Computed:    true,
 				Description: "Minion's public key.",
-				ForceNew:    true,
+			},
+			"master_public_key": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The public key the Salt Master holds for the minion. It differs from `public_key` when another key replaced it or was submitted next to it outside of Terraform, which the next apply restores.",
+			},
+			"fingerprint":         fingerprintSchema(),
+			"fingerprint_sha256":  fingerprintSha256Schema(),
+			"on_destroy":          onDestroySchema("What destroying the resource does with the minion's key: `delete`, which is the default, deletes it, `reject` rejects it so that the minion can not register again, and `abandon` leaves it on the Salt Master."),
+			"deletion_protection": deletionProtectionSchema(),
+			"decommission":        decommissionSchema(),
+			"adopt_existing": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Adopt the key the Salt Master already accepted for the minion, like `terraform import` does, instead of failing to create the key pair. The Salt Master does not keep the private keys, so the adopted key pair has no private key until it is rotated, e.g. by changing `rotation_triggers`. The pending, rejected and denied keys of the minion, which fail the plan otherwise, are replaced by the generated key pair.",
 			},
 		},
 		Importer: &schema.ResourceImporter{
-			StateContext: schema.ImportStatePassthroughContext,
+			StateContext: resourceMinionAcceptedKeyPairImport,
 		},
 	}
 }
@@ -86,117 +151,508 @@ func resourceMinionAcceptedKeyPair() *schema.Resource {
 func resourceMinionAcceptedKeyPairCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
 
-	api := m.(*Client)
+	meta := m.(*providerMeta)
+	api := meta.api
 
-	minionId := d.Get("minion_id").(string)
+	minionId := normalizeMinionId(meta, d.Get("minion_id").(string))
+	d.Set("minion_id", minionId)
 	keySize := d.Get("key_size").(int)
 
-	reqData := map[string]interface{}{
-		"client":  "wheel",
-		"fun":     "key.gen_accept",
-		"id_":     minionId,
-		"keysize": keySize,
+	// The fingerprints are computed once the key changed, so the hash type is resolved before changing it
+	if _, err := meta.HashType(ctx); err != nil {
+		return diag.FromErr(err)
 	}
 
-	tflog.Debug(ctx, fmt.Sprintf("Creating key pair for minion %s", minionId), nil)
-	resp, err := api.Post("/run", reqData)
+	adopted, err := adoptExistingKey(ctx, api, d, minionId)
 	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	var rd KeyPairCreateResult
-
-	err = parseResponseBody(resp, &rd)
-	if err != nil {
-		return diag.FromErr(err)
+	// The pending, rejected and denied keys are replaced when adopt_existing is set
+	if adopted == "" && d.Get("adopt_existing").(bool) {
+		if _, err := api.KeyDeleteMinions(ctx, []string{minionId}); err != nil {
+			return diag.FromErr(err)
+		}
 	}
 
-	if key_pair := rd.Return[0].Data.Return; len(key_pair) == 0 {
+	tflog.Debug(ctx, fmt.Sprintf("Creating key pair for minion %s", minionId), nil)
+	var keyPair saltapi.KeyPair
+	if adopted != "" {
+		keyPair = saltapi.KeyPair{Public: adopted}
 		diags = append(diags, diag.Diagnostic{
-			Severity: diag.Error,
-			Summary:  fmt.Sprintf("The minion %s is already in use.", minionId),
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("Adopted the accepted key of minion %s", minionId),
+			Detail:   "The Salt Master does not keep the private keys, so the private key of the minion is not available. Change rotation_triggers to generate a new key pair.",
 		})
-		return diags
+	} else if d.Get("key_generation").(string) == "local" {
+		privateKey, publicKey, err := helper.GenerateRsaKeyPair(keySize)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		if diags = acceptPublicKey(ctx, api, minionId, publicKey); diags.HasError() {
+			return diags
+		}
+		keyPair = saltapi.KeyPair{Public: publicKey, Private: privateKey}
+	} else {
+		keyPair, err = api.KeyGenAccept(ctx, minionId, keySize, false)
+		if errors.Is(err, saltapi.ErrKeyExists) {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Error,
+				Summary:  fmt.Sprintf("The minion %s is already in use.", minionId),
+			})
+			return diags
+		}
+		if err != nil {
+			return diag.FromErr(err)
+		}
 	}
+
 	tflog.Debug(ctx, fmt.Sprintf("Created key pair for minion %s", minionId), nil)
-	d.Set("public_key", rd.Return[0].Data.Return["pub"])
-	d.Set("private_key", rd.Return[0].Data.Return["priv"])
+	d.Set("public_key", keyPair.Public)
+	d.Set("master_public_key", keyPair.Public)
+	d.Set("rotated_at", now().UTC().Format(time.RFC3339))
 	d.SetId(minionId)
+	if adopted != "" {
+		discardPrivateKey(d)
+	} else if diags = append(diags, storePrivateKey(d, keyPair.Private)...); diags.HasError() {
+		return diags
+	}
+	if err := setKeyFingerprints(ctx, d, meta, keyPair.Public); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if state := d.Get("state").(string); state != "accepted" {
+		stateDiags := applyKeyState(ctx, meta, minionId, keyPair.Public, state)
+		if diags = append(diags, stateDiags...); stateDiags.HasError() {
+			return diags
+		}
+	}
 
-	return resourceMinionAcceptedKeyPairRead(ctx, d, m)
+	return append(diags, readMinionAcceptedKeyPair(ctx, d, m)...)
 }
 
 func resourceMinionAcceptedKeyPairRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return readMinionAcceptedKeyPair(ctx, d, m)
+}
+
+func readMinionAcceptedKeyPair(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
 
 	if d.IsNewResource() {
 		return diags
 	}
 
-	api := m.(*Client)
+	meta := m.(*providerMeta)
 
 	minionId := d.Get("minion_id").(string)
 
-	data := map[string]interface{}{
-		"client": "wheel",
-		"fun":    "key.print",
-		"match":  minionId,
+	state, masterKey, diags := readManagedKey(ctx, meta, minionId, d.Get("public_key").(string))
+	if diags.HasError() {
+		return diags
 	}
 
-	resp, err := api.Post("/run", data)
-	if err != nil {
+	if state == "" {
+		d.SetId("")
+		return diags
+	}
+	if d.Get("public_key").(string) == "" {
+		d.Set("public_key", masterKey)
+	}
+	publicKey := d.Get("public_key").(string)
+	d.Set("state", state)
+	d.Set("master_public_key", masterKey)
+	if err := setKeyFingerprints(ctx, d, meta, publicKey); err != nil {
 		return diag.FromErr(err)
 	}
+	if samePublicKey(masterKey, publicKey) {
+		diags = append(diags, checkKeyFingerprint(ctx, meta, minionId, state, d.Get("fingerprint").(string))...)
+	}
 
-	var rd KeyPairReadResult
+	if keyRotationDue(d.Get("rotated_at").(string), d.Get("rotation_days").(int)) {
+		detail := fmt.Sprintf("The key pair was generated at %s, more than %d days ago. It will be rotated on the next apply.", d.Get("rotated_at"), d.Get("rotation_days"))
+		if d.Get("rotated_at").(string) == "" {
+			detail = "The key pair was imported, so its age is unknown. It will be rotated on the next apply."
+		}
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("The key pair of minion %s is overdue for rotation", minionId),
+			Detail:   detail,
+		})
+	}
 
-	err = parseResponseBody(resp, &rd)
-	if err != nil {
-		return diag.FromErr(err)
+	return diags
+}
+
+func resourceMinionAcceptedKeyPairUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	meta := m.(*providerMeta)
+
+	minionId := d.Get("minion_id").(string)
+	state := d.Get("state").(string)
+
+	var diags diag.Diagnostics
+	rotated, restored := false, false
+	rotatedAt, _ := d.GetChange("rotated_at")
+	masterKey, _ := d.GetChange("master_public_key")
+	if d.HasChanges("key_size", "key_generation", "rotation_triggers") || keyRotationDue(rotatedAt.(string), d.Get("rotation_days").(int)) {
+		if diags = rotateKeyPair(ctx, meta, d); diags.HasError() {
+			return diags
+		}
+		rotated = true
+	} else if !samePublicKey(masterKey.(string), d.Get("public_key").(string)) {
+		if diags := restoreManagedKey(ctx, meta, minionId, d.Get("public_key").(string), state); diags.HasError() {
+			return diags
+		}
+		restored = true
 	}
 
-	if pub_key, ok := rd.Return[0].Data.Return.Minions[minionId]; ok {
-		d.Set("public_key", pub_key)
-	} else {
-		d.SetId("")
+	if !rotated && privateKeyStorageChanged(d) {
+		if diags = append(diags, changePrivateKeyStorage(d)...); diags.HasError() {
+			return diags
+		}
 	}
 
-	return diags
+	// The rotated key is accepted, so a rejected key is rejected again
+	if !restored && (d.HasChange("state") || (rotated && state != "accepted")) {
+		stateDiags := applyKeyState(ctx, meta, minionId, d.Get("public_key").(string), state)
+		if diags = append(diags, stateDiags...); stateDiags.HasError() {
+			return diags
+		}
+	}
+
+	return append(diags, readMinionAcceptedKeyPair(ctx, d, m)...)
 }
 
 func resourceMinionAcceptedKeyPairDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
 
-	api := m.(*Client)
+	meta := m.(*providerMeta)
+	api := meta.api
 
 	minionId := d.Get("minion_id").(string)
+	if !d.Get("deletion_protection").(bool) {
+		diags = decommissionMinion(ctx, api, d, minionId)
+		if diags.HasError() {
+			return diags
+		}
+	}
+
+	return append(diags, destroyKey(ctx, meta, d, minionId, d.Get("public_key").(string))...)
+}
+
+// resourceMinionAcceptedKeyPairImport imports the accepted key of a minion, by minion ID. The private key
+// is not available, as the Salt Master does not keep it.
+func resourceMinionAcceptedKeyPairImport(ctx context.Context, d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	meta := m.(*providerMeta)
+	api := meta.api
 
-	data := map[string]interface{}{
-		"client": "wheel",
-		"fun":    "key.delete",
-		"match":  minionId,
+	minionId := normalizeMinionId(meta, d.Id())
+	d.SetId(minionId)
+
+	keys, err := api.KeyPrintMinions(ctx, []string{minionId})
+	if err != nil {
+		return nil, err
 	}
-	tflog.Debug(ctx, fmt.Sprintf("Deleting key pair for minion %s", minionId), nil)
-	_, err := api.Post("/run", data)
+
+	publicKey, ok := keys[saltapi.KeyAccepted][minionId]
+	if !ok {
+		for _, bucket := range saltapi.KeyBuckets {
+			if _, ok := keys[bucket][minionId]; ok {
+				return nil, fmt.Errorf("The key of minion %s is %s on the Salt Master, only accepted keys can be imported.", minionId, keyStates[bucket])
+			}
+		}
+		return nil, fmt.Errorf("The Salt Master has no key for minion %s.", minionId)
+	}
+
+	keySize, err := helper.RsaPublicKeySize(publicKey)
 	if err != nil {
+		return nil, fmt.Errorf("Unable to read the size of the key of minion %s: %w", minionId, err)
+	}
+
+	d.Set("minion_id", minionId)
+	d.Set("key_size", keySize)
+	d.Set("key_generation", "master")
+	d.Set("private_key_storage", "state")
+	d.Set("state", "accepted")
+	d.Set("public_key", publicKey)
+	d.Set("adopt_existing", false)
+	discardPrivateKey(d)
+
+	return importMinionKey(ctx, d, m)
+}
+
+// adoptExistingKey returns the accepted key of the minion the key pair adopts, if adopt_existing is set
+// and the Salt Master holds one.
+func adoptExistingKey(ctx context.Context, api *saltapi.Client, d *schema.ResourceData, minionId string) (string, error) {
+	if !d.Get("adopt_existing").(bool) {
+		return "", nil
+	}
+
+	keys, err := api.KeyPrintMinions(ctx, []string{minionId})
+	if err != nil {
+		return "", err
+	}
+	publicKey := keys[saltapi.KeyAccepted][minionId]
+	if publicKey != "" {
+		tflog.Info(ctx, fmt.Sprintf("Adopting the accepted key of minion %s", minionId), nil)
+	}
+	return publicKey, nil
+}
+
+func resourceMinionAcceptedKeyPairCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	meta := m.(*providerMeta)
+	api := meta.api
+
+	if err := customizeDiffMinionId(d, meta); err != nil {
+		return err
+	}
+	features := keyFeatures
+	if d.Get("key_generation").(string) == "master" {
+		features = append([]string{"key.gen_accept"}, keyFeatures...)
+	}
+	if err := customizeDiffFeatures(ctx, d, api, features...); err != nil {
+		return err
+	}
+	if d.Id() == "" && d.NewValueKnown("minion_id") {
+		if err := checkExistingKey(ctx, api, normalizeMinionId(meta, d.Get("minion_id").(string)), d.Get("adopt_existing").(bool)); err != nil {
+			return err
+		}
+	}
+
+	if d.Get("private_key_storage").(string) == "encrypted" && d.NewValueKnown("private_key_recipients") && len(d.Get("private_key_recipients").([]interface{})) == 0 {
+		return fmt.Errorf("private_key_recipients must be set to encrypt the private key of minion %s", d.Get("minion_id"))
+	}
+	if d.Get("private_key_storage").(string) == "none" && d.NewValueKnown("private_key_file") && d.Get("private_key_file").(string) == "" {
+		return fmt.Errorf("private_key_file must be set to keep the private key of minion %s, which the state does not hold", d.Get("minion_id"))
+	}
+
+	if d.Id() == "" {
+		if d.Get("private_key_storage").(string) == "none" {
+			return planPrivateKey(d)
+		}
+		return nil
+	}
+
+	if d.HasChanges("key_size", "key_generation", "rotation_triggers") || keyRotationDue(d.Get("rotated_at").(string), d.Get("rotation_days").(int)) {
+		for _, key := range []string{"public_key", "master_public_key", "rotated_at", "fingerprint", "fingerprint_sha256"} {
+			if err := d.SetNewComputed(key); err != nil {
+				return err
+			}
+		}
+		return planPrivateKey(d)
+	}
+
+	// The private key the state holds in plain text is stored again, or discarded
+	if privateKeyStorageChanged(d) && (d.Get("private_key").(string) != "" || d.Get("private_key_storage").(string) == "none") {
+		if err := planPrivateKey(d); err != nil {
+			return err
+		}
+	}
+
+	// The managed key was replaced on the Salt Master
+	if !samePublicKey(d.Get("master_public_key").(string), d.Get("public_key").(string)) {
+		return d.SetNewComputed("master_public_key")
+	}
+	return nil
+}
+
+// rotateKeyPair replaces the keys of a minion with a new key pair, which is accepted. The update rejects
+// it again when the state is rejected.
+func rotateKeyPair(ctx context.Context, meta *providerMeta, d *schema.ResourceData) diag.Diagnostics {
+	api := meta.api
+
+	minionId := d.Get("minion_id").(string)
+	keySize := d.Get("key_size").(int)
+
+	tflog.Debug(ctx, fmt.Sprintf("Rotating key pair for minion %s", minionId), nil)
+	// `key.gen_accept` and the local generation only replace the accepted key, so the keys of the minion are
+	// deleted from every bucket first, as a rejected or pending key would be left next to the rotated one
+	if _, err := api.KeyDeleteMinions(ctx, []string{minionId}); err != nil {
 		return diag.FromErr(err)
 	}
-	tflog.Debug(ctx, fmt.Sprintf("Deleted key pair for minion %s", minionId), nil)
+
+	var keyPair saltapi.KeyPair
+	if d.Get("key_generation").(string) == "local" {
+		privateKey, publicKey, err := helper.GenerateRsaKeyPair(keySize)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		if err := api.KeyWrite(ctx, saltapi.KeyAccepted, minionId, publicKey); err != nil {
+			return diag.FromErr(err)
+		}
+		keyPair = saltapi.KeyPair{Public: publicKey, Private: privateKey}
+	} else {
+		var err error
+		if keyPair, err = api.KeyGenAccept(ctx, minionId, keySize, true); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	tflog.Debug(ctx, fmt.Sprintf("Rotated key pair for minion %s", minionId), nil)
+
+	d.Set("public_key", keyPair.Public)
+	d.Set("master_public_key", keyPair.Public)
+	d.Set("rotated_at", now().UTC().Format(time.RFC3339))
+	diags := storePrivateKey(d, keyPair.Private)
+	if diags.HasError() {
+		return diags
+	}
+	if err := setKeyFingerprints(ctx, d, meta, keyPair.Public); err != nil {
+		return diag.FromErr(err)
+	}
+
 	return diags
 }
 
-func parseResponseBody(resp *http.Response, extractedData interface{}) error {
-	defer resp.Body.Close()
+// privateKeyAttributes are the attributes that hold the private key, depending on private_key_storage.
+var privateKeyAttributes = []string{"private_key", "private_key_pkcs8", "private_key_openssh", "private_key_base64", "private_key_encrypted", "private_key_available"}
+
+// planPrivateKey plans the attributes of a private key which is generated or stored again. The state never
+// holds the private key when private_key_storage is none, so they are known to be empty, and the resources
+// using them do not change.
+func planPrivateKey(d *schema.ResourceDiff) error {
+	for _, key := range privateKeyAttributes {
+		var err error
+		switch {
+		case d.Get("private_key_storage").(string) != "none":
+			err = d.SetNewComputed(key)
+		case key == "private_key_available":
+			err = d.SetNew(key, false)
+		default:
+			err = d.SetNew(key, "")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// privateKeyStorageChanged returns whether the private key is to be stored differently. The recipients
+// only matter to an encrypted private key.
+func privateKeyStorageChanged(d interface {
+	Get(string) interface{}
+	HasChange(string) bool
+}) bool {
+	return d.HasChange("private_key_storage") || (d.Get("private_key_storage").(string) == "encrypted" && d.HasChange("private_key_recipients"))
+}
+
+// storePrivateKey keeps a generated private key in the state as private_key_storage sets it, or writes it
+// to private_key_file.
+func storePrivateKey(d *schema.ResourceData, privateKey string) diag.Diagnostics {
+	if d.Get("private_key_storage").(string) == "none" {
+		discardPrivateKey(d)
+		if err := writePrivateKeyFile(d.Get("private_key_file").(string), privateKey); err != nil {
+			return diag.Errorf("Unable to write the private key of minion %s: %v", d.Get("minion_id"), err)
+		}
+		return nil
+	}
+
+	if d.Get("private_key_storage").(string) != "encrypted" {
+		d.Set("private_key_encrypted", "")
+		d.Set("private_key_available", true)
+		return setPrivateKey(d, privateKey)
+	}
 
-	data, err := ioutil.ReadAll(resp.Body)
+	var recipients []string
+	for _, recipient := range d.Get("private_key_recipients").([]interface{}) {
+		recipients = append(recipients, recipient.(string))
+	}
+	encrypted, err := helper.EncryptKey(privateKey, recipients)
 	if err != nil {
+		return diag.Errorf("Unable to encrypt the private key of minion %s: %v", d.Get("minion_id"), err)
+	}
+	d.Set("private_key_encrypted", encrypted)
+	d.Set("private_key_available", true)
+	return setPrivateKey(d, "")
+}
+
+// writePrivateKeyFile writes a private key PEM to a file only its owner can read.
+func writePrivateKeyFile(path string, privateKey string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(privateKey), 0600); err != nil {
 		return err
 	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(path, 0600)
+}
+
+// discardPrivateKey removes the private key from the state, in all its forms.
+func discardPrivateKey(d *schema.ResourceData) {
+	d.Set("private_key_encrypted", "")
+	d.Set("private_key_available", false)
+	setPrivateKey(d, "")
+}
+
+// changePrivateKeyStorage applies a new private_key_storage to the private key the state holds in plain
+// text. An encrypted or discarded private key can not be recovered, so the new storage applies to the next
+// rotation of the key pair.
+func changePrivateKeyStorage(d *schema.ResourceData) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	if privateKey, _ := d.GetChange("private_key"); privateKey.(string) != "" {
+		return storePrivateKey(d, privateKey.(string))
+	}
+
+	if d.Get("private_key_storage").(string) == "none" {
+		discardPrivateKey(d)
+		return diags
+	}
+
+	diags = append(diags, diag.Diagnostic{
+		Severity: diag.Warning,
+		Summary:  fmt.Sprintf("The private key of minion %s is not available in plain text", d.Get("minion_id")),
+		Detail:   "The state does not hold the private key in plain text, so the new private_key_storage applies to the next rotation of the key pair. Change rotation_triggers to rotate it now.",
+	})
+	return diags
+}
+
+// setPrivateKey sets the private key in the formats the resource exposes. An empty private key clears them.
+// The key is already accepted when it is set, so a failed conversion is reported as a warning only.
+func setPrivateKey(d *schema.ResourceData, privateKey string) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	d.Set("private_key", privateKey)
+	d.Set("private_key_pkcs8", "")
+	d.Set("private_key_openssh", "")
+	d.Set("private_key_base64", "")
+	if privateKey == "" {
+		return diags
+	}
+
+	d.Set("private_key_base64", helper.KeyToBase64(privateKey))
 
-	err = json.Unmarshal(data, extractedData)
+	pkcs8, err := helper.PrivateKeyToPkcs8(privateKey)
+	if err == nil {
+		d.Set("private_key_pkcs8", pkcs8)
+		var openssh string
+		if openssh, err = helper.PrivateKeyToOpenSSH(privateKey); err == nil {
+			d.Set("private_key_openssh", openssh)
+		}
+	}
 	if err != nil {
-		return err
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("Unable to convert the private key of minion %s", d.Get("minion_id")),
+			Detail:   fmt.Sprintf("%v. The private_key_pkcs8 and private_key_openssh attributes are empty.", err),
+		})
 	}
+	return diags
+}
 
-	return nil
+// keyRotationDue returns whether a key pair generated at rotatedAt is older than rotationDays. The age of
+// an imported key pair is unknown, so it is due as soon as rotationDays is set.
+func keyRotationDue(rotatedAt string, rotationDays int) bool {
+	if rotationDays <= 0 {
+		return false
+	}
+	if rotatedAt == "" {
+		return true
+	}
+
+	t, err := time.Parse(time.RFC3339, rotatedAt)
+	if err != nil {
+		return false
+	}
+	return now().After(t.Add(time.Duration(rotationDays) * 24 * time.Hour))
 }
@@ -1,12 +1,29 @@
 package saltstack
 
 import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"github.com/imperva/terraform-provider-saltstack/helper"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi/saltapitest"
+	"golang.org/x/crypto/ssh"
 )
 
 func TestAccSaltstackMinionKeyPair_basic(t *testing.T) {
@@ -20,7 +37,7 @@ func TestAccSaltstackMinionKeyPair_basic(t *testing.T) {
 		CheckDestroy: testAccCheckSaltstackMinionKeyPairDestroy,
 		Steps: []resource.TestStep{
 			{
-				Config: testAccCheckSaltstackMinionKeyPairConfigBasic(minionId, keySize),
+				Config: testKeyPairConfig{MinionId: minionId, KeySize: keySize}.render(),
 				Check: resource.ComposeTestCheckFunc(
 					testAccCheckSaltstackMinionKeyPairExists(resourceName),
 					testAccCheckSaltstackMinionPrivateKey(resourceName),
@@ -31,13 +48,1202 @@ func TestAccSaltstackMinionKeyPair_basic(t *testing.T) {
 	})
 }
 
-func testAccCheckSaltstackMinionKeyPairConfigBasic(minion_id string, key_size int) string {
-	return fmt.Sprintf(`
+func TestSaltstackMinionKeyPair_lifecycle(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	resourceName := "saltstack_minion_key_pair.test"
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, KeySize: 2048}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckSaltstackMinionKeyPairExists(resourceName),
+					testAccCheckSaltstackMinionPrivateKey(resourceName),
+					testCheckSaltstackMinionPrivateKeyFormats(resourceName),
+					testAccCheckSaltstackMinionPublicKey(resourceName),
+					testCheckSaltstackMinionKeyAccepted(server, resourceName, minionId),
+					resource.TestCheckResourceAttrSet(resourceName, "fingerprint"),
+					resource.TestCheckResourceAttrSet(resourceName, "fingerprint_sha256"),
+				),
+			},
+			{
+				// The key is deleted outside of Terraform
+				PreConfig: func() {
+					server.DeleteKey(minionId)
+				},
+				Config:             testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, KeySize: 2048}.render(),
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_localGeneration(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	resourceName := "saltstack_minion_key_pair.test"
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, KeySize: 2048, KeyGeneration: "local"}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckSaltstackMinionPrivateKey(resourceName),
+					testAccCheckSaltstackMinionPublicKey(resourceName),
+					testCheckSaltstackMinionKeyAccepted(server, resourceName, minionId),
+					func(*terraform.State) error {
+						if calls := server.CallsTo("wheel", "key.gen_accept"); len(calls) > 0 {
+							return fmt.Errorf("The key pair was generated by the Salt Master")
+						}
+						for _, call := range server.Calls() {
+							if strings.Contains(fmt.Sprint(call), "PRIVATE KEY") {
+								return fmt.Errorf("The private key was sent to the Salt Master")
+							}
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_state(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	resourceName := "saltstack_minion_key_pair.test"
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, State: "rejected"}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "state", "rejected"),
+					testCheckSaltstackMinionKeyBucket(server, minionId, saltapitest.Rejected),
+				),
+			},
+			{
+				// The key is accepted in place
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, State: "accepted"}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "state", "accepted"),
+					testCheckSaltstackMinionKeyAccepted(server, resourceName, minionId),
+				),
+			},
+			{
+				// The key is denied by the Salt Master
+				PreConfig: func() {
+					_, publicKey, _ := server.Key(minionId)
+					server.DeleteKey(minionId)
+					server.SetKey(saltapitest.Denied, minionId, publicKey)
+				},
+				Config:             testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, State: "accepted"}.render(),
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, State: "accepted"}.render(),
+				Check:  testCheckSaltstackMinionKeyAccepted(server, resourceName, minionId),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_drift(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	resourceName := "saltstack_minion_key_pair.test"
+	config := testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, KeySize: 2048}.render()
+	_, otherPublicKey, _ := saltapitest.GenerateKeyPair(2048)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check:  testCheckSaltstackMinionKeyAccepted(server, resourceName, minionId),
+			},
+			{
+				// The accepted key is replaced outside of Terraform
+				PreConfig: func() {
+					server.SetKey(saltapitest.Accepted, minionId, otherPublicKey)
+				},
+				Config:             config,
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+			{
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					testCheckSaltstackMinionKeyAccepted(server, resourceName, minionId),
+					resource.TestCheckResourceAttrPair(resourceName, "master_public_key", resourceName, "public_key"),
+				),
+			},
+			{
+				// The key is rejected outside of Terraform
+				PreConfig: func() {
+					_, publicKey, _ := server.Key(minionId)
+					server.SetKey(saltapitest.Rejected, minionId, publicKey)
+				},
+				Config:             config,
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+			{
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "state", "accepted"),
+					testCheckSaltstackMinionKeyAccepted(server, resourceName, minionId),
+				),
+			},
+			{
+				// Another machine submits a key with the same minion ID, which the Salt Master denies
+				PreConfig: func() {
+					server.AddKey(saltapitest.Denied, minionId, otherPublicKey)
+				},
+				Config:             config,
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+			{
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					testCheckSaltstackMinionKeyAccepted(server, resourceName, minionId),
+					func(*terraform.State) error {
+						// The managed key was restored in place, never generated again
+						if calls := server.CallsTo("wheel", "key.gen_accept"); len(calls) != 1 {
+							return fmt.Errorf("The key pair of minion %s was generated %d times", minionId, len(calls))
+						}
+						return nil
+					},
+				),
+			},
+			{
+				// The denied key was deleted
+				Config:   config,
+				PlanOnly: true,
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_rotation(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	resourceName := "saltstack_minion_key_pair.test"
+	var publicKey string
+
+	t.Cleanup(func() { now = time.Now })
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, KeyGeneration: "master", RotationDays: 30, RotationVersion: "1"}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet(resourceName, "rotated_at"),
+					testCheckSaltstackMinionKeyPairRotated(resourceName, &publicKey),
+				),
+			},
+			{
+				// The key pair is overdue 31 days later
+				PreConfig: func() {
+					now = func() time.Time { return time.Now().Add(31 * 24 * time.Hour) }
+				},
+				Config:             testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, KeyGeneration: "master", RotationDays: 30, RotationVersion: "1"}.render(),
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, KeyGeneration: "master", RotationDays: 30, RotationVersion: "1"}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					testCheckSaltstackMinionKeyPairRotated(resourceName, &publicKey),
+					testCheckSaltstackMinionKeyAccepted(server, resourceName, minionId),
+				),
+			},
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, KeyGeneration: "master", RotationDays: 30, RotationVersion: "2"}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					testCheckSaltstackMinionKeyPairRotated(resourceName, &publicKey),
+					testCheckSaltstackMinionKeyAccepted(server, resourceName, minionId),
+				),
+			},
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, KeyGeneration: "local", RotationDays: 30, RotationVersion: "2"}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					testCheckSaltstackMinionKeyPairRotated(resourceName, &publicKey),
+					testCheckSaltstackMinionKeyAccepted(server, resourceName, minionId),
+					testCheckSaltstackMinionOnlyKey(server, resourceName, minionId, saltapitest.Accepted),
+					func(*terraform.State) error {
+						// The keys are deleted by exact minion ID, never by glob
+						if calls := server.CallsTo("wheel", "key.delete"); len(calls) > 0 {
+							return fmt.Errorf("The key of minion %s was deleted by glob during the rotation", minionId)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_rotationFromState(t *testing.T) {
+	config := `
 	resource saltstack_minion_key_pair test {
-		minion_id = "%s"
-		key_size = %d
+		minion_id = "test-1.domain.com"
+		state = "%s"
+		rotation_triggers = {
+			version = "%s"
+		}
+	}
+	`
+	for name, tc := range map[string]struct {
+		state  string
+		moveTo string
+		bucket string
+	}{
+		"rejected": {state: "rejected", bucket: saltapitest.Rejected},
+		"pending":  {state: "accepted", moveTo: saltapitest.Pending, bucket: saltapitest.Accepted},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := saltapitest.NewServer(t, "username", "password")
+			minionId := "test-1.domain.com"
+			resourceName := "saltstack_minion_key_pair.test"
+			var publicKey string
+
+			resource.UnitTest(t, resource.TestCase{
+				ProviderFactories: testUnitProviderFactories,
+				CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+				Steps: []resource.TestStep{
+					{
+						Config: testUnitProviderConfig(server) + fmt.Sprintf(config, tc.state, "1"),
+						Check: resource.ComposeTestCheckFunc(
+							testCheckSaltstackMinionKeyPairRotated(resourceName, &publicKey),
+							testCheckSaltstackMinionOnlyKey(server, resourceName, minionId, tc.bucket),
+						),
+					},
+					{
+						// The Salt Master moved the managed key
+						PreConfig: func() {
+							if tc.moveTo != "" {
+								server.SetKey(tc.moveTo, minionId, publicKey)
+							}
+						},
+						Config: testUnitProviderConfig(server) + fmt.Sprintf(config, tc.state, "2"),
+						Check: resource.ComposeTestCheckFunc(
+							testCheckSaltstackMinionKeyPairRotated(resourceName, &publicKey),
+							testCheckSaltstackMinionOnlyKey(server, resourceName, minionId, tc.bucket),
+						),
+					},
+				},
+			})
+		})
+	}
+}
+
+func TestSaltstackMinionKeyPair_import(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	resourceName := "saltstack_minion_key_pair.test"
+	config := testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, KeySize: 3072}.render()
+	_, publicKey, _ := saltapitest.GenerateKeyPair(3072)
+	server.SetKey(saltapitest.Accepted, minionId, publicKey)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+		Steps: []resource.TestStep{
+			{
+				Config:             config,
+				ResourceName:       resourceName,
+				ImportState:        true,
+				ImportStateId:      minionId,
+				ImportStatePersist: true,
+				ImportStateCheck: func(states []*terraform.InstanceState) error {
+					attributes := states[0].Attributes
+					expected := map[string]string{
+						"minion_id":             minionId,
+						"key_size":              "3072",
+						"state":                 "accepted",
+						"public_key":            publicKey,
+						"private_key":           "",
+						"private_key_available": "false",
+					}
+					for k, v := range expected {
+						if attributes[k] != v {
+							return fmt.Errorf("The imported %s is %q instead of %q", k, attributes[k], v)
+						}
+					}
+					return nil
+				},
+			},
+			{
+				// The imported key pair matches the configuration
+				Config:   config,
+				PlanOnly: true,
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_importRotation(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	resourceName := "saltstack_minion_key_pair.test"
+	config := testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, KeyGeneration: "master", RotationDays: 30, RotationVersion: "1"}.render()
+	_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+	server.SetKey(saltapitest.Accepted, minionId, publicKey)
+	imported := publicKey
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+		Steps: []resource.TestStep{
+			{
+				Config:             config,
+				ResourceName:       resourceName,
+				ImportState:        true,
+				ImportStateId:      minionId,
+				ImportStatePersist: true,
+			},
+			{
+				// The age of the imported key pair is unknown, so it is due for rotation
+				Config:             config,
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+			{
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet(resourceName, "rotated_at"),
+					resource.TestCheckResourceAttr(resourceName, "private_key_available", "true"),
+					testCheckSaltstackMinionKeyPairRotated(resourceName, &imported),
+					testCheckSaltstackMinionKeyAccepted(server, resourceName, minionId),
+				),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_importNotAccepted(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+	server.SetKey(saltapitest.Pending, minionId, publicKey)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:        testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, KeySize: 2048}.render(),
+				ResourceName:  "saltstack_minion_key_pair.test",
+				ImportState:   true,
+				ImportStateId: minionId,
+				ExpectError:   regexp.MustCompile(fmt.Sprintf("The key of minion %s is pending on the Salt Master, only\\s+accepted keys can be imported", minionId)),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_privateKeyStorageNone(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	resourceName := "saltstack_minion_key_pair.test"
+	file := filepath.Join(t.TempDir(), "keys", "minion.pem")
+	config := testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, PrivateKeyStorage: "none", PrivateKeyFile: file, RotationVersion: "1"}.render()
+	var publicKey string
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+		Steps: []resource.TestStep{
+			{
+				// The private key is only written to the file, never to the state
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					testCheckSaltstackMinionPrivateKeyNotInState(resourceName),
+					testCheckSaltstackMinionPrivateKeyFile(resourceName, file),
+					testCheckSaltstackMinionKeyPairRotated(resourceName, &publicKey),
+					testCheckSaltstackMinionKeyAccepted(server, resourceName, minionId),
+				),
+			},
+			{
+				Config:   config,
+				PlanOnly: true,
+			},
+			{
+				// The rotation writes the new private key to the file
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, PrivateKeyStorage: "none", PrivateKeyFile: file, RotationVersion: "2"}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					testCheckSaltstackMinionPrivateKeyNotInState(resourceName),
+					testCheckSaltstackMinionPrivateKeyFile(resourceName, file),
+					testCheckSaltstackMinionKeyPairRotated(resourceName, &publicKey),
+				),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_privateKeyFileMissing(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      testUnitProviderConfig(server) + testKeyPairConfig{MinionId: "test-1.domain.com", PrivateKeyStorage: "none"}.render(),
+				ExpectError: regexp.MustCompile("private_key_file must be set"),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_privateKeyStorageEncrypted(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	resourceName := "saltstack_minion_key_pair.test"
+	identity, _ := age.GenerateX25519Identity()
+	config := testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, PrivateKeyStorage: "encrypted", Recipients: []string{identity.Recipient().String()}}.render()
+	var publicKey string
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "private_key", ""),
+					resource.TestCheckResourceAttr(resourceName, "private_key_openssh", ""),
+					resource.TestCheckResourceAttr(resourceName, "private_key_available", "true"),
+					testCheckSaltstackMinionPrivateKeyEncrypted(resourceName, identity),
+					testCheckSaltstackMinionKeyPairRotated(resourceName, &publicKey),
+				),
+			},
+			{
+				Config:   config,
+				PlanOnly: true,
+			},
+			{
+				// The encrypted private key can not be stored in plain text until the next rotation
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, PrivateKeyStorage: "state"}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrPtr(resourceName, "public_key", &publicKey),
+					resource.TestCheckResourceAttr(resourceName, "private_key", ""),
+					testCheckSaltstackMinionPrivateKeyEncrypted(resourceName, identity),
+				),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_privateKeyStorageChange(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	resourceName := "saltstack_minion_key_pair.test"
+	identity, _ := age.GenerateX25519Identity()
+	file := filepath.Join(t.TempDir(), "minion.pem")
+	var publicKey string
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, PrivateKeyStorage: "state"}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					testCheckSaltstackMinionPrivateKeyFormats(resourceName),
+					testCheckSaltstackMinionKeyPairRotated(resourceName, &publicKey),
+				),
+			},
+			{
+				// The private key in plain text is encrypted in place
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, PrivateKeyStorage: "encrypted", Recipients: []string{identity.Recipient().String()}}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrPtr(resourceName, "public_key", &publicKey),
+					resource.TestCheckResourceAttr(resourceName, "private_key", ""),
+					testCheckSaltstackMinionPrivateKeyEncrypted(resourceName, identity),
+				),
+			},
+			{
+				// The encrypted private key can not be written to the file
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, PrivateKeyStorage: "none", PrivateKeyFile: file}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrPtr(resourceName, "public_key", &publicKey),
+					testCheckSaltstackMinionPrivateKeyNotInState(resourceName),
+					testCheckNoFile(file),
+				),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_privateKeyStorageChangeNone(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	resourceName := "saltstack_minion_key_pair.test"
+	file := filepath.Join(t.TempDir(), "minion.pem")
+	var publicKey string
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, PrivateKeyStorage: "state", PrivateKeyFile: file}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					testCheckSaltstackMinionPrivateKeyFormats(resourceName),
+					testCheckSaltstackMinionKeyPairRotated(resourceName, &publicKey),
+					testCheckNoFile(file),
+				),
+			},
+			{
+				// The private key in plain text is moved from the state to the file
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, PrivateKeyStorage: "none", PrivateKeyFile: file}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrPtr(resourceName, "public_key", &publicKey),
+					testCheckSaltstackMinionPrivateKeyNotInState(resourceName),
+					testCheckSaltstackMinionPrivateKeyFile(resourceName, file),
+				),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_privateKeyRecipientsMissing(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+
+	var steps []resource.TestStep
+	for _, step := range []struct {
+		recipients []string
+		err        string
+	}{
+		{nil, "private_key_recipients must be set"},
+		{[]string{"age1notakey"}, "The recipient must be an age public key or an armored PGP public key"},
+	} {
+		steps = append(steps, resource.TestStep{
+			Config:      testUnitProviderConfig(server) + testKeyPairConfig{MinionId: "test-1.domain.com", PrivateKeyStorage: "encrypted", Recipients: step.recipients}.render(),
+			ExpectError: regexp.MustCompile(step.err),
+		})
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps:             steps,
+	})
+}
+
+func TestSaltstackMinionKeyPair_onDestroy(t *testing.T) {
+	for onDestroy, bucket := range map[string]string{"reject": saltapitest.Rejected, "abandon": saltapitest.Accepted} {
+		t.Run(onDestroy, func(t *testing.T) {
+			server := saltapitest.NewServer(t, "username", "password")
+			minionId := "test-1.domain.com"
+
+			resource.UnitTest(t, resource.TestCase{
+				ProviderFactories: testUnitProviderFactories,
+				CheckDestroy:      testCheckSaltstackMinionKeyBucket(server, minionId, bucket),
+				Steps: []resource.TestStep{
+					{
+						Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, OnDestroy: onDestroy}.render(),
+						Check:  testCheckSaltstackMinionKeyBucket(server, minionId, saltapitest.Accepted),
+					},
+				},
+			})
+		})
+	}
+}
+
+func TestSaltstackMinionKeyPair_rejectOtherBuckets(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	_, deniedKey, _ := saltapitest.GenerateKeyPair(2048)
+	var managedKey string
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		// The denied key of another minion using the same ID does not replace the rejected managed key
+		CheckDestroy: func(*terraform.State) error {
+			if _, ok := server.KeyIn(saltapitest.Accepted, minionId); ok {
+				return fmt.Errorf("The key of minion %s is still accepted", minionId)
+			}
+			if key, _ := server.KeyIn(saltapitest.Rejected, minionId); key != managedKey {
+				return fmt.Errorf("The rejected key of minion %s is not the managed key: %q", minionId, key)
+			}
+			if key, _ := server.KeyIn(saltapitest.Denied, minionId); key != deniedKey {
+				return fmt.Errorf("The denied key of minion %s was not left in place: %q", minionId, key)
+			}
+			return nil
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, OnDestroy: "reject"}.render(),
+				Check: func(state *terraform.State) error {
+					managedKey = state.RootModule().Resources["saltstack_minion_key_pair.test"].Primary.Attributes["public_key"]
+					return nil
+				},
+			},
+			{
+				PreConfig: func() {
+					server.AddKey(saltapitest.Denied, minionId, deniedKey)
+				},
+				Config:             testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, OnDestroy: "reject"}.render(),
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_deletionProtection(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, OnDestroy: "delete", DeletionProtection: true}.render(),
+			},
+			{
+				Config:      testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, OnDestroy: "delete", DeletionProtection: true}.render(),
+				Destroy:     true,
+				ExpectError: regexp.MustCompile(fmt.Sprintf("The key of minion %s is protected from deletion", minionId)),
+			},
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, OnDestroy: "delete"}.render(),
+				Check:  testCheckSaltstackMinionKeyBucket(server, minionId, saltapitest.Accepted),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_decommission(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	server.Perms = append(server.Perms, ".*")
+	minionId := "test-1.domain.com"
+	testDecommissionHandlers(server, minionId, 2)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy: resource.ComposeTestCheckFunc(
+			testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+			func(*terraform.State) error {
+				var steps []string
+				for _, low := range server.Calls() {
+					switch fun := low["fun"].(string); fun {
+					case "jobs.active", "cache.clear_all", "saltutil.revoke_auth", "key.check_minion_cache", "key.delete_dict":
+						if len(steps) == 0 || steps[len(steps)-1] != fun {
+							steps = append(steps, fun)
+						}
+					}
+				}
+				expected := []string{"jobs.active", "cache.clear_all", "saltutil.revoke_auth", "key.check_minion_cache"}
+				if strings.Join(steps, " ") != strings.Join(expected, " ") {
+					return fmt.Errorf("The decommission steps were %v instead of %v", steps, expected)
+				}
+				if calls := server.CallsTo("runner", "jobs.active"); len(calls) != 3 {
+					return fmt.Errorf("The jobs were listed %d times instead of 3", len(calls))
+				}
+				return nil
+			},
+		),
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, OnDestroy: "delete", Decommission: true}.render(),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_decommissionFailure(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	testDecommissionHandlers(server, minionId, 0)
+	server.Handle("runner", "cache.clear_all", func(s *saltapitest.Server, low saltapitest.Lowstate) (interface{}, error) {
+		return nil, fmt.Errorf("the minion data cache is not available")
+	})
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, OnDestroy: "delete", Decommission: true, FailOnError: true}.render(),
+			},
+			{
+				// The key is left on the Salt Master
+				Config:      testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, OnDestroy: "delete", Decommission: true, FailOnError: true}.render(),
+				Destroy:     true,
+				ExpectError: regexp.MustCompile("Decommission step clear_cache"),
+			},
+			{
+				// The failed steps are reported as warnings, and the key is deleted by the destroy
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, OnDestroy: "delete", Decommission: true}.render(),
+				Check:  testCheckSaltstackMinionKeyBucket(server, minionId, saltapitest.Accepted),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_decommissionReject(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	server.Perms = append(server.Perms, ".*")
+	minionId := "test-1.domain.com"
+	testDecommissionHandlers(server, minionId, 0)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy: resource.ComposeTestCheckFunc(
+			testCheckSaltstackMinionKeyBucket(server, minionId, saltapitest.Rejected),
+			func(*terraform.State) error {
+				if calls := server.CallsTo("local", "saltutil.revoke_auth"); len(calls) != 0 {
+					return fmt.Errorf("The minion revoked its authentication, which deletes its key instead of rejecting it")
+				}
+				if calls := server.CallsTo("runner", "cache.clear_all"); len(calls) != 1 {
+					return fmt.Errorf("The cache was cleared %d times instead of once", len(calls))
+				}
+				return nil
+			},
+		),
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, OnDestroy: "reject", Decommission: true}.render(),
+			},
+		},
+	})
+}
+
+// TestSaltstackMinionKeyPair_decommissionDiagnostics reports the result of every step, including the steps which succeed.
+func TestSaltstackMinionKeyPair_decommissionDiagnostics(t *testing.T) {
+	tests := []struct {
+		onDestroy string
+		expected  []string
+	}{
+		{"delete", []string{
+			"Decommission step wait_for_jobs: done for minion test-1.domain.com",
+			"Decommission step clear_cache: done for minion test-1.domain.com",
+			"Decommission step revoke_auth: done for minion test-1.domain.com",
+			"Decommission step check_minion_cache: done for minion test-1.domain.com",
+		}},
+		{"reject", []string{
+			"Decommission step wait_for_jobs: done for minion test-1.domain.com",
+			"Decommission step clear_cache: done for minion test-1.domain.com",
+			"Decommission step revoke_auth: skipped for minion test-1.domain.com",
+			"Decommission step check_minion_cache: done for minion test-1.domain.com",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.onDestroy, func(t *testing.T) {
+			server := saltapitest.NewServer(t, "username", "password")
+			server.Perms = append(server.Perms, ".*")
+			minionId := "test-1.domain.com"
+			testDecommissionHandlers(server, minionId, 0)
+			api, err := saltapi.NewClient(saltapi.Config{
+				Host:     server.Host(),
+				Port:     server.Port(),
+				Scheme:   "http",
+				Username: server.Username,
+				Password: server.Password,
+				Eauth:    server.Eauth,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := schema.TestResourceDataRaw(t, resourceMinionAcceptedKeyPair().Schema, map[string]interface{}{
+				"minion_id":  minionId,
+				"on_destroy": test.onDestroy,
+				"decommission": []interface{}{map[string]interface{}{
+					"wait_for_jobs":      true,
+					"clear_cache":        true,
+					"revoke_auth":        true,
+					"check_minion_cache": true,
+				}},
+			})
+
+			diags := decommissionMinion(context.Background(), api, d, minionId)
+			var summaries []string
+			for _, diagnostic := range diags {
+				if diagnostic.Severity != diag.Warning {
+					t.Errorf("The step was reported as an error: %v", diagnostic)
+				}
+				summaries = append(summaries, diagnostic.Summary)
+			}
+			if strings.Join(summaries, "\n") != strings.Join(test.expected, "\n") {
+				t.Errorf("The steps were reported as %q instead of %q", summaries, test.expected)
+			}
+		})
+	}
+}
+
+// testDecommissionHandlers emulates a job running on the minion for the given number of `jobs.active`
+// calls, `cache.clear_all`, and `saltutil.revoke_auth` deleting the key of the minion.
+func testDecommissionHandlers(s *saltapitest.Server, minionId string, runningFor int) {
+	var listed int
+	s.Handle("runner", "jobs.active", func(s *saltapitest.Server, low saltapitest.Lowstate) (interface{}, error) {
+		listed++
+		if listed > runningFor {
+			return map[string]interface{}{}, nil
+		}
+		return map[string]interface{}{
+			"20261019135149.686166": map[string]interface{}{"Function": "state.apply", "Running": []map[string]int{{minionId: 1234}}},
+		}, nil
+	})
+	s.Handle("runner", "cache.clear_all", func(s *saltapitest.Server, low saltapitest.Lowstate) (interface{}, error) {
+		return true, nil
+	})
+	s.Handle("local", "saltutil.revoke_auth", func(s *saltapitest.Server, low saltapitest.Lowstate) (interface{}, error) {
+		s.DeleteKey(minionId)
+		return map[string]bool{minionId: true}, nil
+	})
+}
+
+func TestSaltstackMinionKeyPair_minionId(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	resourceName := "saltstack_minion_key_pair.test"
+	hostname := `^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				// Salt accepts underscores
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: "db_1.domain.com", KeySize: 2048}.render(),
+				Check:  testCheckSaltstackMinionKeyBucket(server, "db_1.domain.com", saltapitest.Accepted),
+			},
+			{
+				Config:      testUnitProviderConfig(server) + testKeyPairConfig{MinionId: "db/1.domain.com", KeySize: 2048}.render(),
+				ExpectError: regexp.MustCompile("The minion ID must be valid for Salt"),
+			},
+			{
+				Config:      testUnitProviderConfigMinionId(server, hostname, false) + testKeyPairConfig{MinionId: "db_2.domain.com", KeySize: 2048}.render(),
+				ExpectError: regexp.MustCompile("does not match the minion_id_pattern of the provider"),
+			},
+			{
+				Config:      testUnitProviderConfigMinionId(server, hostname, false) + testKeyPairConfig{MinionId: strings.Repeat("a", 64) + ".domain.com", KeySize: 2048}.render(),
+				ExpectError: regexp.MustCompile("does not match the minion_id_pattern of the provider"),
+			},
+			{
+				// The minion ID is lowercased before the pattern is checked
+				Config: testUnitProviderConfigMinionId(server, hostname, true) + testKeyPairConfig{MinionId: "Web-1.Domain.com", KeySize: 2048}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "minion_id", "web-1.domain.com"),
+					resource.TestCheckResourceAttr(resourceName, "id", "web-1.domain.com"),
+					testCheckSaltstackMinionKeyBucket(server, "web-1.domain.com", saltapitest.Accepted),
+				),
+			},
+			{
+				Config:   testUnitProviderConfigMinionId(server, hostname, true) + testKeyPairConfig{MinionId: "WEB-1.domain.com", KeySize: 2048}.render(),
+				PlanOnly: true,
+			},
+			{
+				Config:             testUnitProviderConfigMinionId(server, hostname, true) + testKeyPairConfig{MinionId: "web-2.domain.com", KeySize: 2048}.render(),
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_minionIdCase(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	resourceName := "saltstack_minion_key_pair.test"
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + `
+				resource saltstack_minion_key_pair test {
+					key_size = 2048
+				}
+				`,
+				ExpectError: regexp.MustCompile(`The argument "minion_id" is required`),
+			},
+			{
+				// Minion IDs are case sensitive by default
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: "Web-1.domain.com", KeySize: 2048}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "minion_id", "Web-1.domain.com"),
+					testCheckSaltstackMinionKeyBucket(server, "Web-1.domain.com", saltapitest.Accepted),
+				),
+			},
+			{
+				// Changing only the case replaces the key pair
+				Config:             testUnitProviderConfig(server) + testKeyPairConfig{MinionId: "web-1.domain.com", KeySize: 2048}.render(),
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_minionInUse(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	server.SetKey(saltapitest.Accepted, minionId, "existing")
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, KeySize: 2048}.render(),
+				ExpectError: regexp.MustCompile(fmt.Sprintf("The minion %s is already in use", minionId)),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_adoptExisting(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	resourceName := "saltstack_minion_key_pair.test"
+	minionId := "test-1.domain.com"
+	_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+	server.SetKey(saltapitest.Accepted, minionId, publicKey)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+		Steps: []resource.TestStep{
+			{
+				// The plan fails before any key is generated
+				Config:      testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, RotationVersion: "1"}.render(),
+				PlanOnly:    true,
+				ExpectError: regexp.MustCompile(fmt.Sprintf("The minion %s is already in use", minionId)),
+			},
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, AdoptExisting: true, RotationVersion: "1"}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "public_key", publicKey),
+					resource.TestCheckResourceAttr(resourceName, "private_key_available", "false"),
+					resource.TestCheckResourceAttr(resourceName, "private_key", ""),
+					resource.TestCheckResourceAttr(resourceName, "state", "accepted"),
+					testCheckSaltstackMinionKeyManaged(server, minionId, publicKey),
+					func(*terraform.State) error {
+						if calls := server.CallsTo("wheel", "key.gen_accept"); len(calls) != 0 {
+							return fmt.Errorf("A key pair was generated instead of adopting the existing key")
+						}
+						return nil
+					},
+				),
+			},
+			{
+				Config:   testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, AdoptExisting: true, RotationVersion: "1"}.render(),
+				PlanOnly: true,
+			},
+			{
+				// The rotation generates the private key
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, AdoptExisting: true, RotationVersion: "2"}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "private_key_available", "true"),
+					testAccCheckSaltstackMinionPublicKey(resourceName),
+				),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_pendingKeyExists(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+	server.SetKey(saltapitest.Pending, minionId, publicKey)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+		Steps: []resource.TestStep{
+			{
+				// The plan fails before any key is generated
+				Config:      testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, RotationVersion: "1"}.render(),
+				PlanOnly:    true,
+				ExpectError: regexp.MustCompile(fmt.Sprintf("The minion %s is already in use: the Salt Master holds a pending key", minionId)),
+			},
+			{
+				// The pending key is replaced
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, AdoptExisting: true, RotationVersion: "1"}.render(),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckSaltstackMinionPublicKey("saltstack_minion_key_pair.test"),
+					resource.TestCheckResourceAttr("saltstack_minion_key_pair.test", "private_key_available", "true"),
+					testCheckSaltstackMinionOnlyKey(server, "saltstack_minion_key_pair.test", minionId, saltapitest.Accepted),
+				),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_authenticationFailure(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	config := testUnitProviderConfig(server) + testKeyPairConfig{MinionId: "test-1.domain.com", KeySize: 2048}.render()
+	server.Password = "other-password"
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      config,
+				ExpectError: regexp.MustCompile("401 Unauthorized"),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPair_permissionFailure(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	server.Perms = []string{"@runner"}
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      testUnitProviderConfig(server) + testKeyPairConfig{MinionId: "test-1.domain.com", KeySize: 2048}.render(),
+				ExpectError: regexp.MustCompile("401 Unauthorized"),
+			},
+		},
+	})
+}
+
+// TestSaltstackMinionKeyPair_replay replays the salt-api interactions recorded from
+// every Salt Master version in testdata/recordings, see `make testrecord`.
+func TestSaltstackMinionKeyPair_replay(t *testing.T) {
+	fixtures, _ := filepath.Glob("testdata/recordings/*/minion_key_pair.json")
+	if len(fixtures) == 0 {
+		t.Skip("no recorded salt-api interactions")
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(filepath.Base(filepath.Dir(fixture)), func(t *testing.T) {
+			testCheckRecordedFixture(t, fixture, filepath.Base(filepath.Dir(fixture)))
+
+			t.Setenv(saltapi.RecorderModeEnvVar, saltapi.RecorderModeReplay)
+			t.Setenv(saltapi.RecorderFixtureEnvVar, fixture)
+
+			resource.UnitTest(t, resource.TestCase{
+				ProviderFactories: testUnitProviderFactories,
+				Steps: []resource.TestStep{
+					{
+						Config: testReplayProviderConfig() + testKeyPairConfig{MinionId: "test-1.domain.com", KeySize: 2048}.render(),
+						Check: resource.ComposeTestCheckFunc(
+							testAccCheckSaltstackMinionKeyPairExists("saltstack_minion_key_pair.test"),
+							testAccCheckSaltstackMinionPublicKey("saltstack_minion_key_pair.test"),
+						),
+					},
+				},
+			})
+		})
+	}
+}
+
+// Salt formats its job IDs as %Y%m%d%H%M%S%f
+var saltJidRegexp = regexp.MustCompile(`^[0-9]{20}$`)
+
+// testCheckRecordedFixture fails when a fixture was not recorded from a Salt Master of the version,
+// e.g. when it was recorded from the emulator of saltapitest.
+func testCheckRecordedFixture(t *testing.T, path string, version string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fixture saltapi.Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, interaction := range fixture.Interactions {
+		body, _ := interaction.Response.Body.(map[string]interface{})
+		returns, _ := body["return"].([]interface{})
+		for _, ret := range returns {
+			switch ret := ret.(type) {
+			case string:
+				if strings.Contains(fmt.Sprint(interaction.Request.Body), "test.version") && ret != version {
+					t.Fatalf("%s was recorded from Salt %s, not %s", path, ret, version)
+				}
+			case map[string]interface{}:
+				data, _ := ret["data"].(map[string]interface{})
+				if jid, ok := data["jid"].(string); ok && !saltJidRegexp.MatchString(jid) {
+					t.Fatalf("%s was not recorded from a Salt Master: the job ID %s is not formatted by Salt", path, jid)
+				}
+			}
+		}
+	}
+}
+
+// testKeyPairConfig holds the arguments of the saltstack_minion_key_pair of a test step. The zero
+// values are not rendered, so that the resource uses its defaults.
+type testKeyPairConfig struct {
+	MinionId           string
+	KeySize            int
+	KeyGeneration      string
+	State              string
+	AdoptExisting      bool
+	RotationDays       int
+	RotationVersion    string
+	PrivateKeyStorage  string
+	PrivateKeyFile     string
+	Recipients         []string
+	OnDestroy          string
+	DeletionProtection bool
+	// Renders a decommission block, which fails the destroy on error if FailOnError is set.
+	Decommission bool
+	FailOnError  bool
+}
+
+func (c testKeyPairConfig) render() string {
+	var b strings.Builder
+	b.WriteString("\n\tresource saltstack_minion_key_pair test {\n")
+	argument := func(name string, value any) {
+		fmt.Fprintf(&b, "\t\t%s = %v\n", name, value)
+	}
+	argument("minion_id", fmt.Sprintf("%q", c.MinionId))
+	if c.KeySize != 0 {
+		argument("key_size", c.KeySize)
 	}
-	`, minion_id, key_size)
+	if c.KeyGeneration != "" {
+		argument("key_generation", fmt.Sprintf("%q", c.KeyGeneration))
+	}
+	if c.State != "" {
+		argument("state", fmt.Sprintf("%q", c.State))
+	}
+	if c.AdoptExisting {
+		argument("adopt_existing", true)
+	}
+	if c.RotationDays != 0 {
+		argument("rotation_days", c.RotationDays)
+	}
+	if c.RotationVersion != "" {
+		argument("rotation_triggers", fmt.Sprintf("{ version = %q }", c.RotationVersion))
+	}
+	if c.PrivateKeyStorage != "" {
+		argument("private_key_storage", fmt.Sprintf("%q", c.PrivateKeyStorage))
+	}
+	if c.PrivateKeyFile != "" {
+		argument("private_key_file", fmt.Sprintf("%q", c.PrivateKeyFile))
+	}
+	if len(c.Recipients) > 0 {
+		recipients, _ := json.Marshal(c.Recipients)
+		argument("private_key_recipients", string(recipients))
+	}
+	if c.OnDestroy != "" {
+		argument("on_destroy", fmt.Sprintf("%q", c.OnDestroy))
+	}
+	if c.DeletionProtection {
+		argument("deletion_protection", true)
+	}
+	if c.Decommission {
+		fmt.Fprintf(&b, "\t\tdecommission {\n\t\t\tjobs_timeout = \"30s\"\n\t\t\tfail_on_error = %t\n\t\t}\n", c.FailOnError)
+	}
+	b.WriteString("\t}\n")
+	return b.String()
 }
 
 func testAccCheckSaltstackMinionKeyPairExists(resourceName string) resource.TestCheckFunc {
@@ -78,6 +1284,113 @@ func testAccCheckSaltstackMinionPrivateKey(resourceName string) resource.TestChe
 	}
 }
 
+func testCheckSaltstackMinionPrivateKeyFormats(resourceName string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[resourceName]
+		if !ok {
+			return fmt.Errorf("Not found: %s", resourceName)
+		}
+
+		privateKey, err := helper.ParseRsaPrivateKey(rs.Primary.Attributes["private_key"])
+		if err != nil {
+			return err
+		}
+
+		pkcs8, err := helper.ParseRsaPrivateKey(rs.Primary.Attributes["private_key_pkcs8"])
+		if err != nil || !privateKey.Equal(pkcs8) {
+			return fmt.Errorf("The private_key_pkcs8 of %s is not the private key: %v", resourceName, err)
+		}
+
+		openssh, err := ssh.ParseRawPrivateKey([]byte(rs.Primary.Attributes["private_key_openssh"]))
+		if err != nil || !privateKey.Equal(openssh) {
+			return fmt.Errorf("The private_key_openssh of %s is not the private key: %v", resourceName, err)
+		}
+
+		if encoded := helper.KeyToBase64(rs.Primary.Attributes["private_key"]); rs.Primary.Attributes["private_key_base64"] != encoded {
+			return fmt.Errorf("The private_key_base64 of %s is not the encoded private key", resourceName)
+		}
+		return nil
+	}
+}
+
+func testCheckSaltstackMinionPrivateKeyEncrypted(resourceName string, identity *age.X25519Identity) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[resourceName]
+		if !ok {
+			return fmt.Errorf("Not found: %s", resourceName)
+		}
+
+		r, err := age.Decrypt(armor.NewReader(strings.NewReader(rs.Primary.Attributes["private_key_encrypted"])), identity)
+		if err != nil {
+			return fmt.Errorf("The private_key_encrypted of %s can not be decrypted: %v", resourceName, err)
+		}
+		decrypted, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		privateKey, err := helper.ParseRsaPrivateKey(string(decrypted))
+		if err != nil {
+			return err
+		}
+		publicKey, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+		fingerprint, _ := helper.Sha256Fingerprint(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})))
+		if fingerprint != rs.Primary.Attributes["fingerprint_sha256"] {
+			return fmt.Errorf("The private_key_encrypted of %s is not the private key of the minion", resourceName)
+		}
+		return nil
+	}
+}
+
+// testCheckSaltstackMinionPrivateKeyNotInState checks that no attribute of the state holds the private key.
+func testCheckSaltstackMinionPrivateKeyNotInState(resourceName string) resource.TestCheckFunc {
+	checks := []resource.TestCheckFunc{resource.TestCheckResourceAttr(resourceName, "private_key_available", "false")}
+	for _, key := range []string{"private_key", "private_key_pkcs8", "private_key_openssh", "private_key_base64", "private_key_encrypted"} {
+		checks = append(checks, resource.TestCheckResourceAttr(resourceName, key, ""))
+	}
+	return resource.ComposeTestCheckFunc(checks...)
+}
+
+// testCheckSaltstackMinionPrivateKeyFile checks that a file only its owner can read holds the private key
+// of the minion.
+func testCheckSaltstackMinionPrivateKeyFile(resourceName string, file string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[resourceName]
+		if !ok {
+			return fmt.Errorf("Not found: %s", resourceName)
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		if info.Mode().Perm() != 0600 {
+			return fmt.Errorf("The private key file %s has the mode %v instead of 0600", file, info.Mode().Perm())
+		}
+
+		content, _ := os.ReadFile(file)
+		privateKey, err := helper.ParseRsaPrivateKey(string(content))
+		if err != nil {
+			return err
+		}
+		publicKey, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+		fingerprint, _ := helper.Sha256Fingerprint(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})))
+		if fingerprint != rs.Primary.Attributes["fingerprint_sha256"] {
+			return fmt.Errorf("The private key file %s does not hold the private key of the minion", file)
+		}
+		return nil
+	}
+}
+
+func testCheckNoFile(file string) resource.TestCheckFunc {
+	return func(*terraform.State) error {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			return fmt.Errorf("The file %s exists", file)
+		}
+		return nil
+	}
+}
+
 func testAccCheckSaltstackMinionPublicKey(resourceName string) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
 		rs, ok := s.RootModule().Resources[resourceName]
@@ -101,7 +1414,7 @@ func testAccCheckSaltstackMinionPublicKey(resourceName string) resource.TestChec
 }
 
 func testAccCheckSaltstackMinionKeyPairDestroy(s *terraform.State) error {
-	c := testAccProvider.Meta().(*Client)
+	c := testAccProvider.Meta().(*providerMeta).api
 
 	for _, rs := range s.RootModule().Resources {
 		if rs.Type != "saltstack_minion_key_pair" {
@@ -124,3 +1437,71 @@ func testAccCheckSaltstackMinionKeyPairDestroy(s *terraform.State) error {
 
 	return nil
 }
+
+func testCheckSaltstackMinionKeyAccepted(s *saltapitest.Server, resourceName string, minionId string) resource.TestCheckFunc {
+	return func(state *terraform.State) error {
+		bucket, publicKey, ok := s.Key(minionId)
+		if !ok || bucket != saltapitest.Accepted {
+			return fmt.Errorf("The key of minion %s is not accepted", minionId)
+		}
+
+		return resource.TestCheckResourceAttr(resourceName, "public_key", publicKey)(state)
+	}
+}
+
+// testCheckSaltstackMinionKeyPairRotated checks that the public key differs from the previous one, and records it.
+func testCheckSaltstackMinionKeyPairRotated(resourceName string, previous *string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[resourceName]
+		if !ok {
+			return fmt.Errorf("Not found: %s", resourceName)
+		}
+
+		publicKey := rs.Primary.Attributes["public_key"]
+		if publicKey == *previous {
+			return fmt.Errorf("The key pair of %s was not rotated", resourceName)
+		}
+		*previous = publicKey
+		return nil
+	}
+}
+
+// testCheckSaltstackMinionOnlyKey checks that the public key of a resource is the only key of the minion,
+// in the expected bucket.
+func testCheckSaltstackMinionOnlyKey(s *saltapitest.Server, resourceName string, minionId string, expected string) resource.TestCheckFunc {
+	return func(state *terraform.State) error {
+		rs, ok := state.RootModule().Resources[resourceName]
+		if !ok {
+			return fmt.Errorf("Not found: %s", resourceName)
+		}
+
+		for _, bucket := range []string{saltapitest.Accepted, saltapitest.Pending, saltapitest.Rejected, saltapitest.Denied} {
+			key, ok := s.KeyIn(bucket, minionId)
+			switch {
+			case bucket == expected && !samePublicKey(key, rs.Primary.Attributes["public_key"]):
+				return fmt.Errorf("The %s key of minion %s is not the key of %s", bucket, minionId, resourceName)
+			case bucket != expected && ok:
+				return fmt.Errorf("The minion %s has another key in %s", minionId, bucket)
+			}
+		}
+		return nil
+	}
+}
+
+func testCheckSaltstackMinionKeyBucket(s *saltapitest.Server, minionId string, expected string) resource.TestCheckFunc {
+	return func(state *terraform.State) error {
+		if bucket, _, _ := s.Key(minionId); bucket != expected {
+			return fmt.Errorf("The key of minion %s is in %q, expected %q", minionId, bucket, expected)
+		}
+		return nil
+	}
+}
+
+func testCheckSaltstackMinionKeyPairDestroyed(s *saltapitest.Server, minionId string) resource.TestCheckFunc {
+	return func(state *terraform.State) error {
+		if bucket, _, ok := s.Key(minionId); ok {
+			return fmt.Errorf("The key of minion %s still exists in %s", minionId, bucket)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,197 @@
+package saltstack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi"
+)
+
+func resourceMinionKey() *schema.Resource {
+	return &schema.Resource{
+		Description:   "Accepts a public key supplied by the caller for a SaltStack minion. The private key never goes through the Salt Master nor the provider. The public key is written into the `pki_dir` of the Salt Master by the `salt.cmd` runner, so the API user needs the `@runner` permission, which is root-equivalent on the Salt Master.",
+		CreateContext: traceResourceFunc("saltstack_minion_key.Create", warnUndetectedVersion(resourceMinionKeyCreate)),
+		ReadContext:   traceResourceFunc("saltstack_minion_key.Read", resourceMinionKeyRead),
+		UpdateContext: traceResourceFunc("saltstack_minion_key.Update", warnUndetectedVersion(resourceMinionKeyUpdate)),
+		CustomizeDiff: resourceMinionKeyCustomizeDiff,
+		DeleteContext: traceResourceFunc("saltstack_minion_key.Delete", resourceMinionKeyDelete),
+		Schema: map[string]*schema.Schema{
+			"minion_id": {
+				Type:             schema.TypeString,
+				Required:         true,
+				Description:      "The ID of SaltStack minion. When `minion_id_lowercase` is set on the provider, the key is managed under the lowercased ID, and changing only the case of `minion_id` plans nothing.",
+				ForceNew:         true,
+				ValidateDiagFunc: validateMinionId,
+			},
+			"public_key_pem": {
+				Type:             schema.TypeString,
+				Required:         true,
+				Description:      "Minion's RSA public key in PEM format, e.g. the `public_key_pem` of a `tls_private_key` resource.",
+				ForceNew:         true,
+				ValidateDiagFunc: validateRsaPublicKey,
+				DiffSuppressFunc: func(k, old, new string, d *schema.ResourceData) bool {
+					return samePublicKey(old, new)
+				},
+			},
+			"master_public_key": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The public key the Salt Master holds for the minion. It differs from `public_key_pem` when another key replaced it or was submitted next to it outside of Terraform, which the next apply restores.",
+			},
+			"fingerprint":         fingerprintSchema(),
+			"fingerprint_sha256":  fingerprintSha256Schema(),
+			"state":               keyStateSchema("The state of the minion's key: `accepted`, which is the default, or `rejected`. Changing the state accepts or rejects the key in place. When the Salt Master moved the key to another bucket, the state reports it as `pending` or `denied`."),
+			"on_destroy":          onDestroySchema("What destroying the resource does with the minion's key: `delete`, which is the default, deletes it, `reject` rejects it so that the minion can not register again, and `abandon` leaves it on the Salt Master."),
+			"deletion_protection": deletionProtectionSchema(),
+		},
+		Importer: &schema.ResourceImporter{
+			StateContext: importMinionKey,
+		},
+	}
+}
+
+func resourceMinionKeyCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	meta := m.(*providerMeta)
+	api := meta.api
+
+	minionId := normalizeMinionId(meta, d.Get("minion_id").(string))
+	d.Set("minion_id", minionId)
+	publicKey := d.Get("public_key_pem").(string)
+
+	// The fingerprints are computed once the key changed, so the hash type is resolved before changing it
+	if _, err := meta.HashType(ctx); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if diags = acceptPublicKey(ctx, api, minionId, publicKey); diags.HasError() {
+		return diags
+	}
+
+	d.SetId(minionId)
+
+	if state := d.Get("state").(string); state != "accepted" {
+		if diags = applyKeyState(ctx, meta, minionId, publicKey, state); diags.HasError() {
+			return diags
+		}
+	}
+
+	return resourceMinionKeyRead(ctx, d, m)
+}
+
+func resourceMinionKeyRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	meta := m.(*providerMeta)
+
+	minionId := d.Id()
+
+	state, masterKey, diags := readManagedKey(ctx, meta, minionId, d.Get("public_key_pem").(string))
+	if diags.HasError() {
+		return diags
+	}
+
+	if state == "" {
+		if d.IsNewResource() {
+			return diag.Errorf("The public key of minion %s was not accepted by the Salt Master.", minionId)
+		}
+		d.SetId("")
+		return diags
+	}
+
+	if d.Get("public_key_pem").(string) == "" {
+		d.Set("public_key_pem", masterKey)
+	}
+	publicKey := d.Get("public_key_pem").(string)
+	d.Set("minion_id", minionId)
+	d.Set("state", state)
+	d.Set("master_public_key", masterKey)
+	if err := setKeyFingerprints(ctx, d, meta, publicKey); err != nil {
+		return diag.FromErr(err)
+	}
+	if samePublicKey(masterKey, publicKey) {
+		diags = append(diags, checkKeyFingerprint(ctx, meta, minionId, state, d.Get("fingerprint").(string))...)
+	}
+
+	return diags
+}
+
+func resourceMinionKeyUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	meta := m.(*providerMeta)
+
+	minionId := d.Id()
+	state := d.Get("state").(string)
+
+	masterKey, _ := d.GetChange("master_public_key")
+	if publicKey := d.Get("public_key_pem").(string); !samePublicKey(masterKey.(string), publicKey) {
+		if diags := restoreManagedKey(ctx, meta, minionId, publicKey, state); diags.HasError() {
+			return diags
+		}
+	} else if d.HasChange("state") {
+		if diags := applyKeyState(ctx, meta, minionId, publicKey, state); diags.HasError() {
+			return diags
+		}
+	}
+
+	return resourceMinionKeyRead(ctx, d, m)
+}
+
+func resourceMinionKeyDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	meta := m.(*providerMeta)
+
+	return destroyKey(ctx, meta, d, d.Get("minion_id").(string), d.Get("public_key_pem").(string))
+}
+
+func resourceMinionKeyCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	meta := m.(*providerMeta)
+	api := meta.api
+
+	if err := customizeDiffMinionId(d, meta); err != nil {
+		return err
+	}
+	if err := customizeDiffFeatures(ctx, d, api, keyFeatures...); err != nil {
+		return err
+	}
+	if d.Id() == "" && d.NewValueKnown("minion_id") {
+		if err := checkExistingKey(ctx, api, normalizeMinionId(meta, d.Get("minion_id").(string)), false); err != nil {
+			return err
+		}
+	}
+
+	// The managed key was replaced on the Salt Master
+	if d.Id() != "" && !d.HasChange("public_key_pem") && !samePublicKey(d.Get("master_public_key").(string), d.Get("public_key_pem").(string)) {
+		return d.SetNewComputed("master_public_key")
+	}
+	return nil
+}
+
+// acceptPublicKey places the public key of a minion in the pending bucket of the Salt Master and accepts it.
+// The Salt Master must hold no key for the minion in any bucket, e.g. the pending key a minion submitted,
+// which would be overwritten.
+func acceptPublicKey(ctx context.Context, api *saltapi.Client, minionId string, publicKey string) diag.Diagnostics {
+	if err := checkExistingKey(ctx, api, minionId, false); err != nil {
+		return diag.FromErr(err)
+	}
+
+	tflog.Debug(ctx, fmt.Sprintf("Placing the public key of minion %s", minionId), nil)
+	if err := api.KeyWrite(ctx, saltapi.KeyPending, minionId, publicKey); err != nil {
+		return diag.FromErr(err)
+	}
+
+	tflog.Debug(ctx, fmt.Sprintf("Accepting the public key of minion %s", minionId), nil)
+	if _, err := api.KeyAcceptMinions(ctx, saltapi.KeyPending, []string{minionId}); err != nil {
+		return diag.FromErr(err)
+	}
+	tflog.Debug(ctx, fmt.Sprintf("Accepted the public key of minion %s", minionId), nil)
+
+	return nil
+}
+
+// samePublicKey compares PEM public keys regardless of the surrounding whitespace,
+// as Salt stores them with a trailing newline.
+func samePublicKey(a string, b string) bool {
+	return strings.TrimSpace(a) == strings.TrimSpace(b)
+}
@@ -0,0 +1,511 @@
+package saltstack
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/imperva/terraform-provider-saltstack/helper"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi"
+)
+
+func resourceMinionKeyPairs() *schema.Resource {
+	return &schema.Resource{
+		Description:   "Generates and accepts the key pairs of a fleet of SaltStack minions. The key pairs are generated in the provider and their public keys placed on the Salt Master in parallel, then accepted in batches. The minions the Salt Master already holds a key for, in any bucket, are reported as failures and their keys left untouched. The public keys are written into the `pki_dir` of the Salt Master by the `salt.cmd` runner, so the API user needs the `@runner` permission, which is root-equivalent on the Salt Master.",
+		CreateContext: traceResourceFunc("saltstack_minion_key_pairs.Create", warnUndetectedVersion(resourceMinionKeyPairsCreate)),
+		ReadContext:   traceResourceFunc("saltstack_minion_key_pairs.Read", resourceMinionKeyPairsRead),
+		UpdateContext: traceResourceFunc("saltstack_minion_key_pairs.Update", warnUndetectedVersion(resourceMinionKeyPairsUpdate)),
+		DeleteContext: traceResourceFunc("saltstack_minion_key_pairs.Delete", resourceMinionKeyPairsDelete),
+		CustomizeDiff: resourceMinionKeyPairsCustomizeDiff,
+		Schema: map[string]*schema.Schema{
+			"minion_ids": {
+				Type:        schema.TypeSet,
+				Required:    true,
+				Description: "The IDs of the SaltStack minions. Adding or removing minions creates or deletes their key pairs only.",
+				Elem: &schema.Schema{
+					Type:             schema.TypeString,
+					ValidateDiagFunc: validateMinionId,
+				},
+			},
+			"key_size": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "The size of the key pairs to generate. The size must be 2048, which is the default, or greater. If set to a value less than 2048, the key size will be rounded up to 2048. Changing it replaces all the key pairs.",
+				Default:     2048,
+				ForceNew:    true,
+			},
+			"parallelism": {
+				Type:             schema.TypeInt,
+				Optional:         true,
+				Description:      "The number of key pairs generated and placed on the Salt Master at a time, 10 by default.",
+				Default:          10,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.IntBetween(1, 100)),
+			},
+			"batch_size": {
+				Type:             schema.TypeInt,
+				Optional:         true,
+				Description:      "The number of keys accepted or deleted by a single `key.accept_dict` or `key.delete_dict` call, 100 by default.",
+				Default:          100,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.IntAtLeast(1)),
+			},
+			"public_keys": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Description: "Minions' public keys, by minion ID. Minions whose key pairs could not be created, or whose keys were deleted outside of Terraform, are missing until the next apply creates them.",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"private_keys": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Description: "Minions' private keys, by minion ID.",
+				Sensitive:   true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"fingerprints": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Description: "The fingerprints of minions' public keys as Salt's `key.finger` and `salt-key -f` report them, using the `hash_type` of the provider, by minion ID.",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+			"on_destroy":          onDestroySchema("What destroying the resource, or removing minions from `minion_ids`, does with the minions' keys: `delete`, which is the default, deletes them, `reject` rejects them so that the minions can not register again, and `abandon` leaves them on the Salt Master."),
+			"deletion_protection": deletionProtectionSchema(),
+		},
+	}
+}
+
+func resourceMinionKeyPairsCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	meta := m.(*providerMeta)
+	api := meta.api
+
+	minionIds := stringSet(d.Get("minion_ids").(*schema.Set))
+	keyPairs := map[string]saltapi.KeyPair{}
+
+	// The fingerprints are computed once the key changed, so the hash type is resolved before changing it
+	if _, err := meta.HashType(ctx); err != nil {
+		return diag.FromErr(err)
+	}
+
+	created, failed := createKeyPairs(ctx, api, minionIds, d.Get("key_size").(int), d.Get("parallelism").(int), d.Get("batch_size").(int))
+	if len(created) == 0 {
+		return keyPairsFailures(diag.Error, "create", failed)
+	}
+	for id, keyPair := range created {
+		keyPairs[id] = keyPair
+	}
+
+	// The minions which failed are left out of the keys, so that the next apply retries them instead
+	// of tainting the key pairs which were created
+	d.SetId(resource.PrefixedUniqueId("minion-key-pairs-"))
+	if err := setKeyPairs(ctx, d, meta, keyPairs); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return keyPairsFailures(diag.Warning, "create", failed)
+}
+
+func resourceMinionKeyPairsRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	meta := m.(*providerMeta)
+	api := meta.api
+
+	keyPairs := getKeyPairs(d)
+
+	for _, batch := range batches(managedMinionIds(keyPairs), d.Get("batch_size").(int)) {
+		keys, err := api.KeyPrintMinions(ctx, batch)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		for _, id := range batch {
+			publicKey, ok := keys[saltapi.KeyAccepted][id]
+			if !ok {
+				// The key is created again by the next apply
+				tflog.Debug(ctx, fmt.Sprintf("The key of minion %s is not accepted anymore", id), nil)
+				delete(keyPairs, id)
+			} else if !samePublicKey(publicKey, keyPairs[id].Public) {
+				diags = append(diags, diag.Diagnostic{
+					Severity: diag.Warning,
+					Summary:  fmt.Sprintf("The Salt Master holds a different key for minion %s", id),
+					Detail:   "The accepted key of the minion is not the key managed by Terraform. Remove the minion from minion_ids and add it again to generate a new key pair.",
+				})
+			}
+		}
+	}
+
+	if err := setKeyPairs(ctx, d, meta, keyPairs); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return diags
+}
+
+func resourceMinionKeyPairsUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	meta := m.(*providerMeta)
+	api := meta.api
+
+	keyPairs := getKeyPairs(d)
+	added, removed := keyPairsChanges(d.Get("minion_ids").(*schema.Set), managedMinionIds(keyPairs))
+
+	// The state keeps the minions whose key pairs could not be destroyed, and only the created ones
+	if len(removed) > 0 && d.Get("deletion_protection").(bool) {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Error,
+			Summary:  fmt.Sprintf("The keys of %d minions are protected from deletion", len(removed)),
+			Detail:   fmt.Sprintf("deletion_protection is set, so the keys of %s were left on the Salt Master. Unset deletion_protection and apply before removing minions.", strings.Join(removed, ", ")),
+		})
+	} else {
+		destroyed, failed := destroyKeyPairs(ctx, api, removed, d.Get("on_destroy").(string), d.Get("batch_size").(int))
+		for _, id := range destroyed {
+			delete(keyPairs, id)
+		}
+		diags = append(diags, keyPairsFailures(diag.Error, "destroy", failed)...)
+	}
+
+	created, failed := createKeyPairs(ctx, api, added, d.Get("key_size").(int), d.Get("parallelism").(int), d.Get("batch_size").(int))
+	for id, keyPair := range created {
+		keyPairs[id] = keyPair
+	}
+	diags = append(diags, keyPairsFailures(diag.Error, "create", failed)...)
+
+	if err := setKeyPairs(ctx, d, meta, keyPairs); err != nil {
+		return append(diags, diag.FromErr(err)...)
+	}
+
+	return diags
+}
+
+func resourceMinionKeyPairsDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	meta := m.(*providerMeta)
+	api := meta.api
+
+	var diags diag.Diagnostics
+
+	if d.Get("deletion_protection").(bool) {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Error,
+			Summary:  "The keys of the minions are protected from deletion",
+			Detail:   "deletion_protection is set, so the keys were left on the Salt Master. Unset deletion_protection and apply before destroying the resource.",
+		})
+		return diags
+	}
+
+	// Only the keys created by the resource are destroyed
+	_, failed := destroyKeyPairs(ctx, api, managedMinionIds(getKeyPairs(d)), d.Get("on_destroy").(string), d.Get("batch_size").(int))
+	return keyPairsFailures(diag.Error, "destroy", failed)
+}
+
+func resourceMinionKeyPairsCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if !d.NewValueKnown("minion_ids") {
+		return nil
+	}
+
+	// The minion IDs are compared to the keys of the maps, so they are not lowercased
+	meta := m.(*providerMeta)
+	api := meta.api
+	for _, id := range stringSet(d.Get("minion_ids").(*schema.Set)) {
+		if meta.minionIdLowercase && id != strings.ToLower(id) {
+			return fmt.Errorf("The minion ID %s must be lowercase, as minion_id_lowercase is set on the provider", id)
+		}
+		if err := checkMinionId(meta, id); err != nil {
+			return err
+		}
+	}
+
+	if err := customizeDiffFeatures(ctx, d, api, keyFeatures...); err != nil {
+		return err
+	}
+
+	if d.Id() == "" {
+		return nil
+	}
+
+	// The keys of minions were added or removed, failed to be created, or were deleted outside of Terraform
+	var managed []string
+	for id := range d.Get("public_keys").(map[string]interface{}) {
+		managed = append(managed, id)
+	}
+	if added, removed := keyPairsChanges(d.Get("minion_ids").(*schema.Set), managed); len(added) > 0 || len(removed) > 0 {
+		for _, key := range []string{"public_keys", "private_keys", "fingerprints"} {
+			if err := d.SetNewComputed(key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// keyPairsChanges returns the minions whose key pairs are to be created, and the ones whose key pairs are
+// to be deleted.
+func keyPairsChanges(minionIds *schema.Set, managed []string) ([]string, []string) {
+	var added, removed []string
+	isManaged := map[string]bool{}
+	for _, id := range managed {
+		isManaged[id] = true
+		if !minionIds.Contains(id) {
+			removed = append(removed, id)
+		}
+	}
+	for _, id := range stringSet(minionIds) {
+		if !isManaged[id] {
+			added = append(added, id)
+		}
+	}
+	sort.Strings(removed)
+	return added, removed
+}
+
+// createKeyPairs generates the key pairs of minions in the provider and places their public keys in the
+// pending bucket of the Salt Master, up to parallelism minions at a time, then accepts them in batches
+// with `key.accept_dict`. It returns the key pairs which were accepted, and the errors of the others.
+func createKeyPairs(ctx context.Context, api *saltapi.Client, minionIds []string, keySize int, parallelism int, batchSize int) (map[string]saltapi.KeyPair, map[string]error) {
+	created := map[string]saltapi.KeyPair{}
+	failed := map[string]error{}
+	if len(minionIds) == 0 {
+		return created, failed
+	}
+
+	keys, err := api.KeyListAll(ctx)
+	if err != nil {
+		for _, id := range minionIds {
+			failed[id] = err
+		}
+		return created, failed
+	}
+	// A minion holding a key in any bucket is in use, whatever the key the minion submitted
+	inUse := map[string]error{}
+	for _, id := range minionIds {
+		if err := checkExistingKeyIn(ctx, keys, id, false); err != nil {
+			inUse[id] = err
+		}
+	}
+
+	var mu sync.Mutex
+	placed := map[string]saltapi.KeyPair{}
+	ids := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism && i < len(minionIds); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				keyPair, err := placeKeyPair(ctx, api, id, keySize, inUse[id])
+				mu.Lock()
+				if err != nil {
+					failed[id] = err
+				} else {
+					placed[id] = keyPair
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, id := range minionIds {
+		ids <- id
+	}
+	close(ids)
+	wg.Wait()
+
+	pending := make([]string, 0, len(placed))
+	for id := range placed {
+		pending = append(pending, id)
+	}
+	sort.Strings(pending)
+
+	// Only the pending keys placed by the provider are accepted
+	for _, batch := range batches(pending, batchSize) {
+		tflog.Debug(ctx, fmt.Sprintf("Accepting the public keys of %d minions", len(batch)), nil)
+		accepted, err := api.KeyAcceptMinions(ctx, saltapi.KeyPending, batch)
+		isAccepted := map[string]bool{}
+		for _, id := range accepted[saltapi.KeyPending] {
+			isAccepted[id] = true
+		}
+		var left []string
+		for _, id := range batch {
+			switch {
+			case isAccepted[id]:
+				created[id] = placed[id]
+			case err != nil:
+				failed[id] = err
+				left = append(left, id)
+			default:
+				failed[id] = fmt.Errorf("The public key of minion %s was not accepted by the Salt Master.", id)
+				left = append(left, id)
+			}
+		}
+		// Do not leave keys nobody manages in the pending bucket
+		if len(left) > 0 {
+			if err := api.KeyDeleteDict(ctx, map[string][]string{saltapi.KeyPending: left}); err != nil {
+				tflog.Warn(ctx, fmt.Sprintf("Unable to delete the pending keys of %d minions: %v", len(left), err), nil)
+			}
+		}
+	}
+	tflog.Debug(ctx, fmt.Sprintf("Created the key pairs of %d minions", len(created)), nil)
+
+	return created, failed
+}
+
+// placeKeyPair generates the key pair of a minion and places its public key in the pending bucket, unless
+// the minion is in use.
+func placeKeyPair(ctx context.Context, api *saltapi.Client, minionId string, keySize int, inUse error) (saltapi.KeyPair, error) {
+	if inUse != nil {
+		return saltapi.KeyPair{}, inUse
+	}
+	if err := ctx.Err(); err != nil {
+		return saltapi.KeyPair{}, err
+	}
+
+	privateKey, publicKey, err := helper.GenerateRsaKeyPair(keySize)
+	if err != nil {
+		return saltapi.KeyPair{}, err
+	}
+	if err := api.KeyWrite(ctx, saltapi.KeyPending, minionId, publicKey); err != nil {
+		return saltapi.KeyPair{}, err
+	}
+	return saltapi.KeyPair{Public: publicKey, Private: privateKey}, nil
+}
+
+// destroyKeyPairs applies on_destroy to the keys of minions: it deletes them from every bucket in batches
+// with `key.delete_dict`, rejects them with `key.reject_dict`, or leaves them on the Salt Master. The keys
+// are listed before each batch, so that only the exact minion IDs found are passed to Salt. It returns
+// the minions whose keys were destroyed, and the errors of the others.
+func destroyKeyPairs(ctx context.Context, api *saltapi.Client, minionIds []string, onDestroy string, batchSize int) ([]string, map[string]error) {
+	var destroyed []string
+	failed := map[string]error{}
+
+	if onDestroy == "abandon" {
+		tflog.Info(ctx, fmt.Sprintf("Leaving the keys of %d minions on the Salt Master", len(minionIds)), nil)
+		return minionIds, failed
+	}
+
+	for _, batch := range batches(minionIds, batchSize) {
+		var batchDestroyed map[string][]string
+		var err error
+		tflog.Debug(ctx, fmt.Sprintf("Applying %s to the keys of %d minions", onDestroy, len(batch)), nil)
+		if onDestroy == "reject" {
+			batchDestroyed, err = api.KeyRejectMinions(ctx, saltapi.KeyAccepted, batch)
+		} else {
+			batchDestroyed, err = api.KeyDeleteMinions(ctx, batch)
+		}
+		logDestroyedKeys(ctx, onDestroy, batchDestroyed)
+		if err != nil {
+			for _, id := range batch {
+				failed[id] = err
+			}
+			continue
+		}
+		destroyed = append(destroyed, batch...)
+	}
+
+	return destroyed, failed
+}
+
+// keyPairsFailures reports the minions whose key pairs could not be created or deleted in a single
+// diagnostic, as a fleet may fail for the same reason hundreds of times.
+func keyPairsFailures(severity diag.Severity, action string, failed map[string]error) diag.Diagnostics {
+	var diags diag.Diagnostics
+	if len(failed) == 0 {
+		return diags
+	}
+
+	minionIds := make([]string, 0, len(failed))
+	for id := range failed {
+		minionIds = append(minionIds, id)
+	}
+	sort.Strings(minionIds)
+
+	var detail strings.Builder
+	for _, id := range minionIds {
+		detail.WriteString(fmt.Sprintf("%s: %v\n", id, failed[id]))
+	}
+	if severity == diag.Warning {
+		detail.WriteString("The next apply retries them.")
+	}
+
+	diags = append(diags, diag.Diagnostic{
+		Severity: severity,
+		Summary:  fmt.Sprintf("Unable to %s the key pairs of %d minions", action, len(failed)),
+		Detail:   strings.TrimSpace(detail.String()),
+	})
+	return diags
+}
+
+// getKeyPairs returns the key pairs the prior state holds, by minion ID, as the plan of an update
+// leaves the keys unknown.
+func getKeyPairs(d *schema.ResourceData) map[string]saltapi.KeyPair {
+	keyPairs := map[string]saltapi.KeyPair{}
+	publicKeys, _ := d.GetChange("public_keys")
+	privateKeys, _ := d.GetChange("private_keys")
+	for id, publicKey := range publicKeys.(map[string]interface{}) {
+		privateKey, _ := privateKeys.(map[string]interface{})[id].(string)
+		keyPairs[id] = saltapi.KeyPair{Public: publicKey.(string), Private: privateKey}
+	}
+	return keyPairs
+}
+
+// managedMinionIds returns the sorted IDs of the minions whose key pairs the resource created.
+func managedMinionIds(keyPairs map[string]saltapi.KeyPair) []string {
+	minionIds := make([]string, 0, len(keyPairs))
+	for id := range keyPairs {
+		minionIds = append(minionIds, id)
+	}
+	sort.Strings(minionIds)
+	return minionIds
+}
+
+// setKeyPairs sets the keys of the managed minions.
+func setKeyPairs(ctx context.Context, d *schema.ResourceData, meta *providerMeta, keyPairs map[string]saltapi.KeyPair) error {
+	hashType, err := meta.HashType(ctx)
+	if err != nil {
+		return err
+	}
+
+	publicKeys := map[string]string{}
+	privateKeys := map[string]string{}
+	fingerprints := map[string]string{}
+	for id, keyPair := range keyPairs {
+		fingerprint, err := helper.SaltFingerprint(keyPair.Public, hashType)
+		if err != nil {
+			return err
+		}
+		publicKeys[id] = keyPair.Public
+		privateKeys[id] = keyPair.Private
+		fingerprints[id] = fingerprint
+	}
+
+	d.Set("public_keys", publicKeys)
+	d.Set("private_keys", privateKeys)
+	d.Set("fingerprints", fingerprints)
+	return nil
+}
+
+// stringSet returns the sorted strings of a set.
+func stringSet(s *schema.Set) []string {
+	values := make([]string, 0, s.Len())
+	for _, v := range s.List() {
+		values = append(values, v.(string))
+	}
+	sort.Strings(values)
+	return values
+}
+
+// batches splits minion IDs in batches of the given size.
+func batches(minionIds []string, size int) [][]string {
+	var ret [][]string
+	for size < len(minionIds) {
+		minionIds, ret = minionIds[size:], append(ret, minionIds[:size])
+	}
+	if len(minionIds) > 0 {
+		ret = append(ret, minionIds)
+	}
+	return ret
+}
@@ -0,0 +1,203 @@
+package saltstack
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/imperva/terraform-provider-saltstack/helper"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi/saltapitest"
+)
+
+func TestSaltstackMinionKeyPairs_lifecycle(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	resourceName := "saltstack_minion_key_pairs.test"
+	fleet := []string{"web-1.domain.com", "web-2.domain.com", "web-3.domain.com", "web-4.domain.com", "web-5.domain.com"}
+	resized := []string{"web-1.domain.com", "web-2.domain.com", "web-5.domain.com", "web-6.domain.com"}
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairsDestroyed(server, append(fleet, resized...)),
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMinionKeyPairsConfig(fleet),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "minion_ids.#", "5"),
+					testCheckSaltstackMinionKeyPairsAccepted(server, resourceName, fleet),
+					func(*terraform.State) error {
+						// 5 keys accepted 2 at a time
+						if calls := server.CallsTo("wheel", "key.accept_dict"); len(calls) != 3 {
+							return fmt.Errorf("The keys were accepted by %d key.accept_dict calls instead of 3", len(calls))
+						}
+						return nil
+					},
+				),
+			},
+			{
+				Config:   testUnitProviderConfig(server) + testCheckSaltstackMinionKeyPairsConfig(fleet),
+				PlanOnly: true,
+			},
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMinionKeyPairsConfig(resized),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "public_keys.%", "4"),
+					resource.TestCheckNoResourceAttr(resourceName, "public_keys.web-3.domain.com"),
+					testCheckSaltstackMinionKeyPairsAccepted(server, resourceName, resized),
+					testCheckSaltstackMinionKeyPairsDestroyed(server, []string{"web-3.domain.com", "web-4.domain.com"}),
+				),
+			},
+			{
+				// A key is deleted outside of Terraform
+				PreConfig: func() {
+					server.DeleteKey("web-6.domain.com")
+				},
+				Config:             testUnitProviderConfig(server) + testCheckSaltstackMinionKeyPairsConfig(resized),
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMinionKeyPairsConfig(resized),
+				Check:  testCheckSaltstackMinionKeyPairsAccepted(server, resourceName, resized),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPairs_partialFailure(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	resourceName := "saltstack_minion_key_pairs.test"
+	fleet := []string{"web-1.domain.com", "web-2.domain.com", "web-3.domain.com", "web-4.domain.com"}
+
+	// Other machines already use two of the minion IDs: the key of one is accepted, the other one
+	// submitted its key, which is pending
+	_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+	server.SetKey(saltapitest.Accepted, "web-2.domain.com", publicKey)
+	_, pendingKey, _ := saltapitest.GenerateKeyPair(2048)
+	server.SetKey(saltapitest.Pending, "web-4.domain.com", pendingKey)
+	checkInUse := resource.ComposeTestCheckFunc(
+		testCheckSaltstackMinionKeyManaged(server, "web-2.domain.com", publicKey),
+		func(*terraform.State) error {
+			if bucket, key, _ := server.Key("web-4.domain.com"); bucket != saltapitest.Pending || key != pendingKey {
+				return fmt.Errorf("The pending key of minion web-4.domain.com was replaced")
+			}
+			return nil
+		},
+	)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy: resource.ComposeTestCheckFunc(
+			testCheckSaltstackMinionKeyPairsDestroyed(server, []string{"web-1.domain.com", "web-3.domain.com"}),
+			checkInUse,
+		),
+		Steps: []resource.TestStep{
+			{
+				// The created key pairs are kept, and the next plan retries the minions which failed
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMinionKeyPairsConfig(fleet),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "public_keys.%", "2"),
+					resource.TestCheckNoResourceAttr(resourceName, "public_keys.web-2.domain.com"),
+					resource.TestCheckNoResourceAttr(resourceName, "public_keys.web-4.domain.com"),
+					testCheckSaltstackMinionKeyPairsAccepted(server, resourceName, []string{"web-1.domain.com", "web-3.domain.com"}),
+					checkInUse,
+				),
+				ExpectNonEmptyPlan: true,
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyPairs_onDestroy(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	fleet := []string{"web-1.domain.com", "web-2.domain.com", "web-3.domain.com"}
+	config := func(minionIds []string, deletionProtection bool) string {
+		return testUnitProviderConfig(server) + fmt.Sprintf(`
+		resource saltstack_minion_key_pairs test {
+			minion_ids          = ["%s"]
+			on_destroy          = "reject"
+			deletion_protection = %t
+		}
+		`, strings.Join(minionIds, `", "`), deletionProtection)
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy: resource.ComposeTestCheckFunc(
+			testCheckSaltstackMinionKeyBucket(server, "web-1.domain.com", saltapitest.Rejected),
+			testCheckSaltstackMinionKeyBucket(server, "web-2.domain.com", saltapitest.Rejected),
+			testCheckSaltstackMinionKeyBucket(server, "web-3.domain.com", saltapitest.Rejected),
+		),
+		Steps: []resource.TestStep{
+			{
+				Config: config(fleet, true),
+			},
+			{
+				// The protected keys are kept, and the next plan removes them again
+				Config:      config(fleet[:2], true),
+				ExpectError: regexp.MustCompile("The keys of 1 minions are protected from deletion"),
+			},
+			{
+				Config: config(fleet[:2], false),
+				Check:  testCheckSaltstackMinionKeyBucket(server, "web-3.domain.com", saltapitest.Rejected),
+			},
+		},
+	})
+}
+
+func testCheckSaltstackMinionKeyPairsConfig(minionIds []string) string {
+	return fmt.Sprintf(`
+	resource saltstack_minion_key_pairs test {
+		minion_ids  = ["%s"]
+		parallelism = 3
+		batch_size  = 2
+	}
+	`, strings.Join(minionIds, `", "`))
+}
+
+// testCheckSaltstackMinionKeyPairsAccepted checks that the keys of the minions are accepted with the public
+// key of the state, and match the private key.
+func testCheckSaltstackMinionKeyPairsAccepted(s *saltapitest.Server, resourceName string, minionIds []string) resource.TestCheckFunc {
+	return func(state *terraform.State) error {
+		rs, ok := state.RootModule().Resources[resourceName]
+		if !ok {
+			return fmt.Errorf("Not found: %s", resourceName)
+		}
+
+		for _, id := range minionIds {
+			bucket, publicKey, ok := s.Key(id)
+			if !ok || bucket != saltapitest.Accepted {
+				return fmt.Errorf("The key of minion %s is not accepted", id)
+			}
+			if !samePublicKey(publicKey, rs.Primary.Attributes["public_keys."+id]) {
+				return fmt.Errorf("The accepted key of minion %s is not the public key of %s", id, resourceName)
+			}
+
+			privateKey, err := helper.ParseRsaPrivateKey(rs.Primary.Attributes["private_keys."+id])
+			if err != nil {
+				return fmt.Errorf("The private key of minion %s is not valid: %v", id, err)
+			}
+			fingerprint, _ := helper.SaltFingerprint(publicKey, "sha256")
+			if rs.Primary.Attributes["fingerprints."+id] != fingerprint {
+				return fmt.Errorf("The fingerprint of minion %s is not the one of its key", id)
+			}
+			if privateKey.N.BitLen() != 2048 {
+				return fmt.Errorf("The key of minion %s is %d bits long", id, privateKey.N.BitLen())
+			}
+		}
+		return nil
+	}
+}
+
+func testCheckSaltstackMinionKeyPairsDestroyed(s *saltapitest.Server, minionIds []string) resource.TestCheckFunc {
+	return func(*terraform.State) error {
+		for _, id := range minionIds {
+			if bucket, _, ok := s.Key(id); ok {
+				return fmt.Errorf("The key of minion %s is still in %s", id, bucket)
+			}
+		}
+		return nil
+	}
+}
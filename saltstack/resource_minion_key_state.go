@@ -0,0 +1,165 @@
+package saltstack
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func resourceMinionKeyState() *schema.Resource {
+	return &schema.Resource{
+		Description:   "Manages the state of a key which a SaltStack minion submitted to the Salt Master by itself, accepting or rejecting it in place. With `expected_fingerprint`, the key is only accepted once the minion submitted it and its fingerprint matches. Only that key is moved: the apply fails when the Salt Master holds keys for the minion in several buckets. Destroying the resource deletes the key, unless `on_destroy` is set otherwise.",
+		CreateContext: traceResourceFunc("saltstack_minion_key_state.Create", warnUndetectedVersion(resourceMinionKeyStateCreate)),
+		ReadContext:   traceResourceFunc("saltstack_minion_key_state.Read", resourceMinionKeyStateRead),
+		UpdateContext: traceResourceFunc("saltstack_minion_key_state.Update", warnUndetectedVersion(resourceMinionKeyStateUpdate)),
+		DeleteContext: traceResourceFunc("saltstack_minion_key_state.Delete", resourceMinionKeyStateDelete),
+		CustomizeDiff: resourceMinionKeyStateCustomizeDiff,
+		Schema: map[string]*schema.Schema{
+			"minion_id": {
+				Type:             schema.TypeString,
+				Required:         true,
+				Description:      "The ID of SaltStack minion. When `minion_id_lowercase` is set on the provider, the key is managed under the lowercased ID, and changing only the case of `minion_id` plans nothing.",
+				ForceNew:         true,
+				ValidateDiagFunc: validateMinionId,
+			},
+			"state": {
+				Type:             schema.TypeString,
+				Required:         true,
+				Description:      "The state of the minion's key: `accepted` or `rejected`. When the Salt Master moved the key to another bucket, the state reports it as `pending` or `denied`.",
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice(settableKeyStates, false)),
+			},
+			"expected_fingerprint": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Description:      "The fingerprint the minion's key must have, as reported by `salt-key -f` with the `hash_type` of the Salt Master. When set, the provider waits up to the create timeout for the minion to submit its key, and fails without changing the key state if the fingerprint does not match.",
+				ForceNew:         true,
+				ValidateDiagFunc: validateFingerprint,
+			},
+			"public_key": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The public key submitted by the minion.",
+			},
+			"fingerprint":         fingerprintSchema(),
+			"fingerprint_sha256":  fingerprintSha256Schema(),
+			"on_destroy":          onDestroySchema("What destroying the resource does with the minion's key: `delete`, which is the default, deletes it, `reject` rejects it so that the minion can not register again, and `abandon` leaves it on the Salt Master."),
+			"deletion_protection": deletionProtectionSchema(),
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+		},
+		Importer: &schema.ResourceImporter{
+			StateContext: importMinionKey,
+		},
+	}
+}
+
+func resourceMinionKeyStateCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	meta := m.(*providerMeta)
+	api := meta.api
+
+	minionId := normalizeMinionId(meta, d.Get("minion_id").(string))
+	d.Set("minion_id", minionId)
+	state := d.Get("state").(string)
+
+	// The fingerprints are computed once the key changed, so the hash type is resolved before changing it
+	if _, err := meta.HashType(ctx); err != nil {
+		return diag.FromErr(err)
+	}
+
+	expected := d.Get("expected_fingerprint").(string)
+	if expected != "" {
+		if err := waitForKey(ctx, api, minionId, d.Timeout(schema.TimeoutCreate)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	// Only the key which was read, and verified, is moved
+	bucket, publicKey, diags := readSingleKey(ctx, meta, minionId)
+	if diags.HasError() {
+		return diags
+	}
+	if bucket == "" {
+		return diag.Errorf("The minion %s did not submit a key to the Salt Master.", minionId)
+	}
+	if expected != "" {
+		if diags := verifyFingerprint(ctx, api, minionId, bucket, expected); diags.HasError() {
+			return diags
+		}
+	}
+
+	if keyStates[bucket] != state {
+		if diags = applyKeyState(ctx, meta, minionId, publicKey, state); diags.HasError() {
+			return diags
+		}
+	}
+
+	d.SetId(minionId)
+
+	return append(diags, resourceMinionKeyStateRead(ctx, d, m)...)
+}
+
+func resourceMinionKeyStateRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	meta := m.(*providerMeta)
+	api := meta.api
+
+	minionId := d.Id()
+
+	state, publicKey, err := readKey(ctx, api, minionId)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if state == "" {
+		d.SetId("")
+		return diags
+	}
+
+	d.Set("minion_id", minionId)
+	d.Set("state", state)
+	d.Set("public_key", publicKey)
+	if err := setKeyFingerprints(ctx, d, meta, publicKey); err != nil {
+		return diag.FromErr(err)
+	}
+	diags = append(diags, checkKeyFingerprint(ctx, meta, minionId, state, d.Get("fingerprint").(string))...)
+
+	return diags
+}
+
+func resourceMinionKeyStateUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	meta := m.(*providerMeta)
+
+	var diags diag.Diagnostics
+	if d.HasChange("state") {
+		var publicKey string
+		if _, publicKey, diags = readSingleKey(ctx, meta, d.Id()); diags.HasError() {
+			return diags
+		}
+		if diags = applyKeyState(ctx, meta, d.Id(), publicKey, d.Get("state").(string)); diags.HasError() {
+			return diags
+		}
+	}
+
+	return append(diags, resourceMinionKeyStateRead(ctx, d, m)...)
+}
+
+func resourceMinionKeyStateDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	meta := m.(*providerMeta)
+
+	return destroyKey(ctx, meta, d, d.Id(), d.Get("public_key").(string))
+}
+
+func resourceMinionKeyStateCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	meta := m.(*providerMeta)
+	api := meta.api
+
+	if err := customizeDiffMinionId(d, meta); err != nil {
+		return err
+	}
+	return customizeDiffFeatures(ctx, d, api, keyFeatures...)
+}
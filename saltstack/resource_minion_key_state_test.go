@@ -0,0 +1,196 @@
+package saltstack
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi/saltapitest"
+)
+
+func TestSaltstackMinionKeyState_lifecycle(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	resourceName := "saltstack_minion_key_state.test"
+	_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+
+	// The minion submitted its key by itself
+	server.SetKey(saltapitest.Pending, minionId, publicKey)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMinionKeyStateConfig(minionId, "accepted"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "id", minionId),
+					resource.TestCheckResourceAttr(resourceName, "state", "accepted"),
+					resource.TestCheckResourceAttr(resourceName, "public_key", publicKey),
+					testCheckSaltstackMinionKeyBucket(server, minionId, saltapitest.Accepted),
+				),
+			},
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMinionKeyStateConfig(minionId, "rejected"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "state", "rejected"),
+					testCheckSaltstackMinionKeyBucket(server, minionId, saltapitest.Rejected),
+				),
+			},
+			{
+				ResourceName:      resourceName,
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+			{
+				// The key is denied by the Salt Master
+				PreConfig: func() {
+					server.DeleteKey(minionId)
+					server.SetKey(saltapitest.Denied, minionId, publicKey)
+				},
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMinionKeyStateConfig(minionId, "accepted"),
+				Check:  testCheckSaltstackMinionKeyBucket(server, minionId, saltapitest.Accepted),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyState_notSubmitted(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      testUnitProviderConfig(server) + testCheckSaltstackMinionKeyStateConfig(minionId, "accepted"),
+				ExpectError: regexp.MustCompile(fmt.Sprintf("The minion %s did not submit a key", minionId)),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyState_expectedFingerprint(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+	fingerprint, _ := saltapitest.Fingerprint(publicKey, "sha256")
+
+	// The minion submits its key on first boot, after the apply started
+	go func() {
+		time.Sleep(time.Second)
+		server.SetKey(saltapitest.Pending, minionId, publicKey)
+	}()
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMinionKeyStateConfigFingerprint(minionId, fingerprint, "1m"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("saltstack_minion_key_state.test", "state", "accepted"),
+					testCheckSaltstackMinionKeyBucket(server, minionId, saltapitest.Accepted),
+				),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyState_fingerprintMismatch(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+	_, otherPublicKey, _ := saltapitest.GenerateKeyPair(2048)
+	fingerprint, _ := saltapitest.Fingerprint(otherPublicKey, "sha256")
+	server.SetKey(saltapitest.Pending, minionId, publicKey)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyBucket(server, minionId, saltapitest.Pending),
+		Steps: []resource.TestStep{
+			{
+				Config:      testUnitProviderConfig(server) + testCheckSaltstackMinionKeyStateConfigFingerprint(minionId, fingerprint, "1m"),
+				ExpectError: regexp.MustCompile(fmt.Sprintf("The key of minion %s does not match the expected\\s+fingerprint", minionId)),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyState_severalBuckets(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+	_, deniedKey, _ := saltapitest.GenerateKeyPair(2048)
+	fingerprint, _ := saltapitest.Fingerprint(publicKey, "sha256")
+
+	// The minion submitted the expected key, and another host submitted a key for the same ID
+	server.SetKey(saltapitest.Pending, minionId, publicKey)
+	server.AddKey(saltapitest.Denied, minionId, deniedKey)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy: func(*terraform.State) error {
+			if _, ok := server.KeyIn(saltapitest.Accepted, minionId); ok {
+				return fmt.Errorf("A key of minion %s was accepted", minionId)
+			}
+			if key, _ := server.KeyIn(saltapitest.Pending, minionId); key != publicKey {
+				return fmt.Errorf("The pending key of minion %s was not left in place", minionId)
+			}
+			if key, _ := server.KeyIn(saltapitest.Denied, minionId); key != deniedKey {
+				return fmt.Errorf("The denied key of minion %s was not left in place", minionId)
+			}
+			if calls := server.CallsTo("wheel", "key.accept_dict"); len(calls) > 0 {
+				return fmt.Errorf("The keys were accepted: %v", calls)
+			}
+			return nil
+		},
+		Steps: []resource.TestStep{
+			{
+				Config:      testUnitProviderConfig(server) + testCheckSaltstackMinionKeyStateConfigFingerprint(minionId, fingerprint, "1m"),
+				ExpectError: regexp.MustCompile(fmt.Sprintf("The Salt Master holds keys for minion %s in several\\s+buckets", minionId)),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKeyState_fingerprintTimeout(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      testUnitProviderConfig(server) + testCheckSaltstackMinionKeyStateConfigFingerprint(minionId, "aa:bb", "2s"),
+				ExpectError: regexp.MustCompile(fmt.Sprintf("The minion %s did not submit a key to the Salt Master\\s+within 2s", minionId)),
+			},
+		},
+	})
+}
+
+func testCheckSaltstackMinionKeyStateConfig(minionId string, state string) string {
+	return fmt.Sprintf(`
+	resource saltstack_minion_key_state test {
+		minion_id = "%s"
+		state = "%s"
+	}
+	`, minionId, state)
+}
+
+func testCheckSaltstackMinionKeyStateConfigFingerprint(minionId string, fingerprint string, timeout string) string {
+	return fmt.Sprintf(`
+	resource saltstack_minion_key_state test {
+		minion_id = "%s"
+		state = "accepted"
+		expected_fingerprint = "%s"
+
+		timeouts {
+			create = "%s"
+		}
+	}
+	`, minionId, fingerprint, timeout)
+}
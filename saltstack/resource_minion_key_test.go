@@ -0,0 +1,241 @@
+package saltstack
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/imperva/terraform-provider-saltstack/helper"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi/saltapitest"
+)
+
+func TestSaltstackMinionKey_lifecycle(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	resourceName := "saltstack_minion_key.test"
+	_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+	_, otherPublicKey, _ := saltapitest.GenerateKeyPair(2048)
+	fingerprint, _ := saltapitest.Fingerprint(publicKey, "sha256")
+	fingerprintSha256, _ := helper.Sha256Fingerprint(publicKey)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		CheckDestroy:      testCheckSaltstackMinionKeyPairDestroyed(server, minionId),
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMinionKeyConfig(minionId, publicKey),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "id", minionId),
+					testCheckSaltstackMinionKeyManaged(server, minionId, publicKey),
+					resource.TestCheckResourceAttr(resourceName, "fingerprint", fingerprint),
+					resource.TestCheckResourceAttr(resourceName, "fingerprint_sha256", fingerprintSha256),
+				),
+			},
+			{
+				ResourceName:      resourceName,
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+			{
+				// The key is replaced outside of Terraform
+				PreConfig: func() {
+					server.SetKey(saltapitest.Accepted, minionId, otherPublicKey)
+				},
+				Config:             testUnitProviderConfig(server) + testCheckSaltstackMinionKeyConfig(minionId, publicKey),
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMinionKeyConfig(minionId, publicKey),
+				Check:  testCheckSaltstackMinionKeyManaged(server, minionId, publicKey),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKey_hashType(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+	fingerprint, _ := saltapitest.Fingerprint(publicKey, "md5")
+
+	t.Setenv("SALTSTACK_HASH_TYPE", "md5")
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMinionKeyConfig(minionId, publicKey),
+				Check:  resource.TestCheckResourceAttr("saltstack_minion_key.test", "fingerprint", fingerprint),
+			},
+		},
+	})
+}
+
+// TestSaltstackMinionKey_detectedHashType reads the hash_type of the Salt Master when the provider does not set it.
+func TestSaltstackMinionKey_detectedHashType(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	server.Config["hash_type"] = "sha512"
+	minionId := "test-1.domain.com"
+	_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+	fingerprint, _ := saltapitest.Fingerprint(publicKey, "sha512")
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMinionKeyConfig(minionId, publicKey),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("saltstack_minion_key.test", "fingerprint", fingerprint),
+					func(*terraform.State) error {
+						// The detection is not repeated by every operation
+						var calls int
+						for _, call := range server.CallsTo("runner", "salt.cmd") {
+							if fmt.Sprint(call["arg"]) == "[config.get hash_type]" {
+								calls++
+							}
+						}
+						if calls != 1 {
+							return fmt.Errorf("The hash_type was read %d times instead of once", calls)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+// TestSaltstackMinionKey_hashTypeNotDetected fails instead of assuming a hash type the Salt Master may not use.
+func TestSaltstackMinionKey_hashTypeNotDetected(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	server.Perms = []string{"@wheel"}
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      testUnitProviderConfig(server) + testKeyPairConfig{MinionId: "test-1.domain.com", KeySize: 2048}.render(),
+				ExpectError: regexp.MustCompile("Set the hash_type of the provider"),
+			},
+			{
+				PreConfig: func() {
+					t.Setenv("SALTSTACK_HASH_TYPE", "sha256")
+				},
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: "test-1.domain.com", KeySize: 2048}.render(),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKey_invalidPublicKey(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      testUnitProviderConfig(server) + testCheckSaltstackMinionKeyConfig("test-1.domain.com", "-----BEGIN PUBLIC KEY-----\nnot a key\n-----END PUBLIC KEY-----"),
+				ExpectError: regexp.MustCompile("The public key must be an RSA public key in PEM format"),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKey_minionInUse(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+	server.SetKey(saltapitest.Accepted, minionId, "existing")
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      testUnitProviderConfig(server) + testCheckSaltstackMinionKeyConfig(minionId, publicKey),
+				ExpectError: regexp.MustCompile(fmt.Sprintf("The minion %s is already in use", minionId)),
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionKey_pendingKeyExists(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+	_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+	_, pendingKey, _ := saltapitest.GenerateKeyPair(2048)
+	server.SetKey(saltapitest.Pending, minionId, pendingKey)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      testUnitProviderConfig(server) + testCheckSaltstackMinionKeyConfig(minionId, publicKey),
+				ExpectError: regexp.MustCompile(fmt.Sprintf("The minion %s is already in use: the Salt Master holds a pending key", minionId)),
+			},
+		},
+	})
+}
+
+// TestSaltstackMinionKey_keySubmittedAfterPlan checks the keys of the minion again before writing the public key,
+// as the minion may submit its key between the plan and the apply.
+func TestSaltstackMinionKey_keySubmittedAfterPlan(t *testing.T) {
+	for _, bucket := range []string{saltapitest.Pending, saltapitest.Rejected, saltapitest.Denied} {
+		t.Run(bucket, func(t *testing.T) {
+			server := saltapitest.NewServer(t, "username", "password")
+			minionId := "test-1.domain.com"
+			_, publicKey, _ := saltapitest.GenerateKeyPair(2048)
+			_, submittedKey, _ := saltapitest.GenerateKeyPair(2048)
+			server.SetKey(bucket, minionId, submittedKey)
+			api, err := saltapi.NewClient(saltapi.Config{
+				Host:     server.Host(),
+				Port:     server.Port(),
+				Scheme:   "http",
+				Username: server.Username,
+				Password: server.Password,
+				Eauth:    server.Eauth,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			diags := acceptPublicKey(context.Background(), api, minionId, publicKey)
+			if !diags.HasError() || !strings.Contains(diags[0].Summary, fmt.Sprintf("The minion %s is already in use", minionId)) {
+				t.Fatalf("The key was placed while the minion had a key in %s: %v", bucket, diags)
+			}
+			if b, key, _ := server.Key(minionId); b != bucket || key != submittedKey {
+				t.Errorf("The key the minion submitted was replaced")
+			}
+			if calls := server.CallsTo("runner", "salt.cmd"); len(calls) > 0 {
+				t.Errorf("The public key was written: %v", calls)
+			}
+		})
+	}
+}
+
+func testCheckSaltstackMinionKeyConfig(minionId string, publicKey string) string {
+	return fmt.Sprintf(`
+	resource saltstack_minion_key test {
+		minion_id = "%s"
+		public_key_pem = %q
+	}
+	`, minionId, publicKey)
+}
+
+func testCheckSaltstackMinionKeyManaged(s *saltapitest.Server, minionId string, publicKey string) resource.TestCheckFunc {
+	return func(state *terraform.State) error {
+		bucket, key, ok := s.Key(minionId)
+		if !ok || bucket != saltapitest.Accepted {
+			return fmt.Errorf("The key of minion %s is not accepted", minionId)
+		}
+		if !samePublicKey(key, publicKey) {
+			return fmt.Errorf("The accepted key of minion %s is not the managed one", minionId)
+		}
+		return nil
+	}
+}
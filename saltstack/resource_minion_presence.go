@@ -0,0 +1,153 @@
+package saltstack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi"
+)
+
+// presenceGrains are the grains of a minion the presence resource exposes.
+var presenceGrains = []string{"saltversion", "os"}
+
+func resourceMinionPresence() *schema.Resource {
+	return &schema.Resource{
+		Description:   "Waits for a SaltStack minion to be up, by polling it with `test.ping` until it answers, e.g. to run states on a new machine only once its minion connected to the Salt Master. Destroying the resource does nothing to the minion.",
+		CreateContext: traceResourceFunc("saltstack_minion_presence.Create", resourceMinionPresenceCreate),
+		ReadContext:   traceResourceFunc("saltstack_minion_presence.Read", resourceMinionPresenceRead),
+		DeleteContext: traceResourceFunc("saltstack_minion_presence.Delete", resourceMinionPresenceDelete),
+		CustomizeDiff: resourceMinionPresenceCustomizeDiff,
+		Schema: map[string]*schema.Schema{
+			"minion_id": {
+				Type:             schema.TypeString,
+				Required:         true,
+				Description:      "The ID of SaltStack minion. When `minion_id_lowercase` is set on the provider, the key is managed under the lowercased ID, and changing only the case of `minion_id` plans nothing.",
+				ForceNew:         true,
+				ValidateDiagFunc: validateMinionId,
+			},
+			"poll_interval": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          "10s",
+				Description:      "How long to wait between two `test.ping` of the minion, e.g. `5s` or `1m`. Defaults to `10s`. The provider waits for the minion up to the create timeout.",
+				ForceNew:         true,
+				ValidateDiagFunc: validateDuration,
+			},
+			"triggers": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Description: "Arbitrary values which, when changed, make the provider wait for the minion again, e.g. the ID of the machine running it.",
+				ForceNew:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"saltversion": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The version of Salt the minion runs, as reported by its `saltversion` grain.",
+			},
+			"os": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The operating system of the minion, as reported by its `os` grain.",
+			},
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(10 * time.Minute),
+		},
+	}
+}
+
+func resourceMinionPresenceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	meta := m.(*providerMeta)
+	api := meta.api
+
+	minionId := normalizeMinionId(meta, d.Get("minion_id").(string))
+	d.Set("minion_id", minionId)
+	interval, _ := time.ParseDuration(d.Get("poll_interval").(string))
+
+	if err := waitForMinion(ctx, api, minionId, interval, d.Timeout(schema.TimeoutCreate)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(minionId)
+
+	return resourceMinionPresenceRead(ctx, d, m)
+}
+
+func resourceMinionPresenceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	meta := m.(*providerMeta)
+	api := meta.api
+
+	minionId := d.Id()
+
+	grains, ok, err := api.GrainsItem(ctx, minionId, presenceGrains...)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// A minion which went down since it was seen keeps its grains, the resource only waits for it once
+	if !ok {
+		tflog.Info(ctx, fmt.Sprintf("Minion %s did not answer, keeping its grains", minionId), nil)
+		return diags
+	}
+
+	d.Set("minion_id", minionId)
+	for _, grain := range presenceGrains {
+		if value, ok := grains[grain]; ok {
+			d.Set(grain, fmt.Sprint(value))
+		}
+	}
+
+	return diags
+}
+
+func resourceMinionPresenceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	d.SetId("")
+
+	return diags
+}
+
+func resourceMinionPresenceCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	return customizeDiffMinionId(d, m.(*providerMeta))
+}
+
+// waitForMinion polls a minion with `test.ping` every interval until it answers.
+func waitForMinion(ctx context.Context, api *saltapi.Client, minionId string, interval time.Duration, timeout time.Duration) error {
+	tflog.Debug(ctx, fmt.Sprintf("Waiting for minion %s to answer test.ping", minionId), nil)
+	conf := &resource.StateChangeConf{
+		Pending:      []string{"offline"},
+		Target:       []string{"online"},
+		Timeout:      timeout,
+		PollInterval: interval,
+		Refresh: func() (interface{}, string, error) {
+			online, err := api.TestPing(ctx, minionId)
+			if err != nil {
+				return nil, "", err
+			}
+			if !online {
+				return minionId, "offline", nil
+			}
+			return minionId, "online", nil
+		},
+	}
+
+	// The create timeout also bounds the context, which may expire during a `test.ping` before the wait times out
+	_, err := conf.WaitForStateContext(ctx)
+	var timeoutErr *resource.TimeoutError
+	if errors.As(err, &timeoutErr) || errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("The minion %s did not answer test.ping within %s.", minionId, timeout)
+	}
+	return err
+}
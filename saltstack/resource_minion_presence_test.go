@@ -0,0 +1,95 @@
+package saltstack
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi/saltapitest"
+)
+
+func TestSaltstackMinionPresence_lifecycle(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	server.Perms = append(server.Perms, ".*")
+	minionId := "test-1.domain.com"
+	resourceName := "saltstack_minion_presence.test"
+
+	// The minion answers its third test.ping
+	pings := 0
+	server.Handle("local", "test.ping", func(s *saltapitest.Server, low saltapitest.Lowstate) (interface{}, error) {
+		if pings++; pings < 3 {
+			return map[string]bool{}, nil
+		}
+		return map[string]bool{minionId: true}, nil
+	})
+	online := true
+	server.Handle("local", "grains.item", func(s *saltapitest.Server, low saltapitest.Lowstate) (interface{}, error) {
+		if !online {
+			return map[string]string{minionId: "Minion did not return. [No response]"}, nil
+		}
+		return map[string]interface{}{minionId: map[string]string{"saltversion": "3004.2", "os": "Ubuntu"}}, nil
+	})
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackMinionPresenceConfig(minionId, "20m"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "id", minionId),
+					resource.TestCheckResourceAttr(resourceName, "saltversion", "3004.2"),
+					resource.TestCheckResourceAttr(resourceName, "os", "Ubuntu"),
+					func(*terraform.State) error {
+						if pings != 3 {
+							return fmt.Errorf("expected 3 test.ping, got %d", pings)
+						}
+						return nil
+					},
+				),
+			},
+			{
+				// The minion went down since, it keeps its grains
+				PreConfig: func() {
+					online = false
+				},
+				Config:   testUnitProviderConfig(server) + testCheckSaltstackMinionPresenceConfig(minionId, "20m"),
+				PlanOnly: true,
+			},
+		},
+	})
+}
+
+func TestSaltstackMinionPresence_timeout(t *testing.T) {
+	server := saltapitest.NewServer(t, "username", "password")
+	server.Perms = append(server.Perms, ".*")
+	minionId := "test-1.domain.com"
+
+	server.Handle("local", "test.ping", func(s *saltapitest.Server, low saltapitest.Lowstate) (interface{}, error) {
+		return map[string]bool{}, nil
+	})
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      testUnitProviderConfig(server) + testCheckSaltstackMinionPresenceConfig(minionId, "2s"),
+				ExpectError: regexp.MustCompile(fmt.Sprintf("The minion %s did not answer test.ping within 2s", minionId)),
+			},
+		},
+	})
+}
+
+func testCheckSaltstackMinionPresenceConfig(minionId string, timeout string) string {
+	return fmt.Sprintf(`
+	resource saltstack_minion_presence test {
+		minion_id = "%s"
+		poll_interval = "100ms"
+
+		timeouts {
+			create = "%s"
+		}
+	}
+	`, minionId, timeout)
+}
@@ -0,0 +1,85 @@
+package saltstack
+
+import (
+	"context"
+	"os"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/imperva/terraform-provider-saltstack"
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// SetupTracing exports the provider spans with OTLP over HTTP when an OTLP endpoint is configured
+// with the standard OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT environment
+// variables, unless OTEL_TRACES_EXPORTER is `none`. The returned function flushes the spans.
+func SetupTracing(ctx context.Context) (func(context.Context) error, error) {
+	noop := func(context.Context) error { return nil }
+
+	if os.Getenv("OTEL_TRACES_EXPORTER") == "none" ||
+		(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "") {
+		return noop, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return noop, err
+	}
+
+	// The resource honours OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES
+	res, err := resource.Merge(
+		resource.NewSchemaless(semconv.ServiceNameKey.String("terraform-provider-saltstack")),
+		resource.Environment(),
+	)
+	if err != nil {
+		return noop, err
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+// traceResourceFunc wraps a CRUD function of a resource in a span named after the operation,
+// e.g. `saltstack_minion_key_pair.Create`.
+func traceResourceFunc(operation string, f func(context.Context, *schema.ResourceData, interface{}) diag.Diagnostics) func(context.Context, *schema.ResourceData, interface{}) diag.Diagnostics {
+	return func(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+		ctx, span := tracer().Start(ctx, operation)
+		defer span.End()
+
+		if hasAttribute(d, "minion_id") {
+			if minionId, ok := d.Get("minion_id").(string); ok && minionId != "" {
+				span.SetAttributes(attribute.String("salt.minion_id", minionId))
+			}
+		}
+
+		diags := f(ctx, d, m)
+		for _, dg := range diags {
+			if dg.Severity == diag.Error {
+				span.SetStatus(codes.Error, dg.Summary)
+				break
+			}
+		}
+		return diags
+	}
+}
+
+// hasAttribute tells whether the schema of a resource has an attribute. The raw configuration is typed
+// by the schema even when it is null, e.g. in a Delete.
+func hasAttribute(d *schema.ResourceData, name string) bool {
+	t := d.GetRawConfig().Type()
+	return t.IsObjectType() && t.HasAttribute(name)
+}
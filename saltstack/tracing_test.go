@@ -0,0 +1,100 @@
+package saltstack
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/imperva/terraform-provider-saltstack/pkg/saltapi/saltapitest"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func testTracingExporter(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestTracingResourceOperations(t *testing.T) {
+	exporter := testTracingExporter(t)
+	server := saltapitest.NewServer(t, "username", "password")
+	minionId := "test-1.domain.com"
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testKeyPairConfig{MinionId: minionId, KeySize: 2048}.render(),
+			},
+		},
+	})
+
+	parents := map[string]string{}
+	for _, span := range exporter.GetSpans() {
+		parents[span.SpanContext.SpanID().String()] = span.Name
+	}
+
+	var operations []string
+	for _, span := range exporter.GetSpans() {
+		switch span.Name {
+		case "saltstack_minion_key_pair.Create", "saltstack_minion_key_pair.Read", "saltstack_minion_key_pair.Delete":
+			operations = append(operations, span.Name)
+			assert.Equal(t, minionId, spanAttributes(span)["salt.minion_id"].AsString())
+		case "salt-api /run":
+			if fun := spanAttributes(span)["salt.fun"].AsString(); fun == "key.gen_accept" {
+				assert.Equal(t, "saltstack_minion_key_pair.Create", parents[span.Parent.SpanID().String()])
+			}
+		}
+	}
+	assert.Contains(t, operations, "saltstack_minion_key_pair.Create")
+	assert.Contains(t, operations, "saltstack_minion_key_pair.Read")
+	assert.Contains(t, operations, "saltstack_minion_key_pair.Delete")
+}
+
+func TestTracingResourceWithoutMinionId(t *testing.T) {
+	exporter := testTracingExporter(t)
+	server := saltapitest.NewServer(t, "username", "password")
+
+	resource.UnitTest(t, resource.TestCase{
+		ProviderFactories: testUnitProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testUnitProviderConfig(server) + testCheckSaltstackAcceptedKeysExclusiveConfig("*", "reject", true),
+			},
+		},
+	})
+
+	var operations []string
+	for _, span := range exporter.GetSpans() {
+		switch span.Name {
+		case "saltstack_accepted_keys_exclusive.Create", "saltstack_accepted_keys_exclusive.Read", "saltstack_accepted_keys_exclusive.Delete":
+			operations = append(operations, span.Name)
+			assert.NotContains(t, spanAttributes(span), attribute.Key("salt.minion_id"))
+		}
+	}
+	assert.Contains(t, operations, "saltstack_accepted_keys_exclusive.Create")
+	assert.Contains(t, operations, "saltstack_accepted_keys_exclusive.Delete")
+}
+
+func TestHasAttribute(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceAcceptedKeysExclusive().Schema, map[string]interface{}{})
+	assert.False(t, hasAttribute(d, "minion_id"))
+	assert.True(t, hasAttribute(d, "minion_ids"))
+
+	d = schema.TestResourceDataRaw(t, resourceMinionAcceptedKeyPair().Schema, map[string]interface{}{})
+	assert.True(t, hasAttribute(d, "minion_id"))
+}
@@ -0,0 +1,145 @@
+package saltstack
+
+import (
+	"fmt"
+
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/imperva/terraform-provider-saltstack/helper"
+	"github.com/imperva/terraform-provider-saltstack/pkg/fnmatch"
+)
+
+func validateMinionId(v any, p cty.Path) diag.Diagnostics {
+	var diags diag.Diagnostics
+	if err := helper.ValidateMinionId(v.(string)); err != nil {
+		diags = append(diags, diag.Diagnostic{
+			Severity:      diag.Error,
+			Summary:       "Wrong value",
+			Detail:        fmt.Sprintf("The minion ID must be valid for Salt: %v.", err),
+			AttributePath: p,
+		})
+	}
+	return diags
+}
+
+// normalizeMinionId lowercases a minion ID if minion_id_lowercase is set on the provider.
+func normalizeMinionId(meta *providerMeta, minionId string) string {
+	if meta.minionIdLowercase {
+		return strings.ToLower(minionId)
+	}
+	return minionId
+}
+
+// checkMinionId checks a normalized minion ID against the minion_id_pattern of the provider.
+func checkMinionId(meta *providerMeta, minionId string) error {
+	if meta.minionIdPattern == "" {
+		return nil
+	}
+	if matched, _ := regexp.MatchString(meta.minionIdPattern, minionId); !matched {
+		return fmt.Errorf("The minion ID %s does not match the minion_id_pattern of the provider, %s", minionId, meta.minionIdPattern)
+	}
+	return nil
+}
+
+// suppressMinionIdCase returns the DiffSuppressFunc of the minion_id of the resources, which ignores a
+// change of case if minion_id_lowercase is set on the provider. The schema functions are not passed the
+// meta, so it is read from the configured provider.
+func suppressMinionIdCase(provider *schema.Provider) schema.SchemaDiffSuppressFunc {
+	return func(k, old, new string, d *schema.ResourceData) bool {
+		meta, ok := provider.Meta().(*providerMeta)
+		return ok && meta.minionIdLowercase && strings.EqualFold(old, new)
+	}
+}
+
+// customizeDiffMinionId checks the minion ID of a resource which is created or replaced against the
+// minion_id_pattern of the provider, once lowercased if minion_id_lowercase is set on the provider.
+func customizeDiffMinionId(d *schema.ResourceDiff, meta *providerMeta) error {
+	if !d.NewValueKnown("minion_id") || (d.Id() != "" && !d.HasChange("minion_id")) {
+		return nil
+	}
+	return checkMinionId(meta, normalizeMinionId(meta, d.Get("minion_id").(string)))
+}
+
+func validateRsaPublicKey(v any, p cty.Path) diag.Diagnostics {
+	var diags diag.Diagnostics
+	if err := helper.ValidateRsaPublicKey(v.(string)); err != nil {
+		diags = append(diags, diag.Diagnostic{
+			Severity:      diag.Error,
+			Summary:       "Wrong value",
+			Detail:        fmt.Sprintf("The public key must be an RSA public key in PEM format: %v.", err),
+			AttributePath: p,
+		})
+	}
+	return diags
+}
+
+func validateRsaPrivateKey(v any, p cty.Path) diag.Diagnostics {
+	var diags diag.Diagnostics
+	if err := helper.ValidateRsaPrivateKey(v.(string)); err != nil {
+		diags = append(diags, diag.Diagnostic{
+			Severity:      diag.Error,
+			Summary:       "Wrong value",
+			Detail:        fmt.Sprintf("The private key must be an RSA private key in PEM format: %v.", err),
+			AttributePath: p,
+		})
+	}
+	return diags
+}
+
+func validateFingerprint(v any, p cty.Path) diag.Diagnostics {
+	value := v.(string)
+	var diags diag.Diagnostics
+	if matched, _ := regexp.MatchString("^[0-9a-fA-F]{2}(:[0-9a-fA-F]{2})+$", value); !matched {
+		diags = append(diags, diag.Diagnostic{
+			Severity:      diag.Error,
+			Summary:       "Wrong value",
+			Detail:        fmt.Sprintf("The fingerprint must be colon separated hex pairs as reported by `salt-key -f`, the value %s is wrong.", value),
+			AttributePath: p,
+		})
+	}
+	return diags
+}
+
+func validateKeyRecipient(v any, p cty.Path) diag.Diagnostics {
+	var diags diag.Diagnostics
+	if err := helper.ValidateKeyRecipient(v.(string)); err != nil {
+		diags = append(diags, diag.Diagnostic{
+			Severity:      diag.Error,
+			Summary:       "Wrong value",
+			Detail:        fmt.Sprintf("The recipient must be an age public key or an armored PGP public key: %v.", err),
+			AttributePath: p,
+		})
+	}
+	return diags
+}
+
+func validateGlob(v any, p cty.Path) diag.Diagnostics {
+	var diags diag.Diagnostics
+	if _, err := fnmatch.Compile(v.(string)); err != nil {
+		diags = append(diags, diag.Diagnostic{
+			Severity:      diag.Error,
+			Summary:       "Wrong value",
+			Detail:        fmt.Sprintf("The value must be a glob of minion IDs, e.g. `web-*`: %v.", err),
+			AttributePath: p,
+		})
+	}
+	return diags
+}
+
+func validateDuration(v any, p cty.Path) diag.Diagnostics {
+	var diags diag.Diagnostics
+	if _, err := time.ParseDuration(v.(string)); err != nil {
+		diags = append(diags, diag.Diagnostic{
+			Severity:      diag.Error,
+			Summary:       "Wrong value",
+			Detail:        fmt.Sprintf("The value must be a duration, e.g. `30s` or `5m`: %v.", err),
+			AttributePath: p,
+		})
+	}
+	return diags
+}